@@ -0,0 +1,27 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// ListCollisions prints the hostnames claimed more than once and
+// how the configured policy settles them
+func ListCollisions(elog service.Logger, cfg *config.Config) error {
+	s := service.New(elog, wslapi.Default, cfg)
+	collisions, err := s.Collisions()
+	if err != nil {
+		return err
+	}
+	if len(collisions) == 0 {
+		fmt.Println("no hostname collisions")
+		return nil
+	}
+	for _, c := range collisions {
+		fmt.Println(c)
+	}
+	return nil
+}
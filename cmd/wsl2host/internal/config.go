@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+)
+
+// LoadConfig loads the configuration file at path, the one in
+// the user configuration directory when path is empty
+func LoadConfig(path string) (*config.Config, error) {
+	if path == "" {
+		var err error
+		path, err = config.DefaultPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate configuration: %w", err)
+		}
+	}
+	return config.Load(path)
+}
+
+// ValidateConfig checks the configuration file at path, the
+// default one when path is empty
+func ValidateConfig(path string) error {
+	if path == "" {
+		var err error
+		path, err = config.DefaultPath()
+		if err != nil {
+			return fmt.Errorf("failed to locate configuration: %w", err)
+		}
+	}
+	_, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s: configuration is valid\n", path)
+	return nil
+}
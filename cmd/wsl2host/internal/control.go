@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/control"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+)
+
+// serviceClient returns a client of the control API of the
+// running service
+func serviceClient() (*control.Client, error) {
+	addr, err := control.DefaultAddr()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate control API: %w", err)
+	}
+	return control.NewClient(addr), nil
+}
+
+// unavailable reports whether err means the service is not
+// running, the command then doing the work itself
+func unavailable(err error) bool {
+	return errors.Is(err, control.ErrUnavailable)
+}
+
+// SetTargetPaused stops or resumes the updates of a target by the
+// running service
+func SetTargetPaused(target string, paused bool) error {
+	c, err := serviceClient()
+	if err != nil {
+		return err
+	}
+	return c.SetPaused(reconcile.Target(target), paused)
+}
+
+// PrintLogs prints the last n lines logged by the running service
+func PrintLogs(n int) error {
+	c, err := serviceClient()
+	if err != nil {
+		return err
+	}
+	lines, err := c.Logs(n)
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		fmt.Printf("%s %-7s %s\n", l.Time.Format("2006-01-02 15:04:05"), l.Level, l.Message)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/pkg/dnsserver"
+)
+
+// RunDNS answers DNS queries for the distro hostnames in the
+// foreground until interrupted, refreshing the records when the
+// distros change without touching the hosts files, so it can run
+// next to the installed service
+// listen and upstream override the configured addresses when set
+func RunDNS(elog service.Logger, listen, upstream string) error {
+	r, err := newReconciler(elog, "", func(cfg *config.Config) {
+		cfg.DNS.Enabled = true
+		if listen != "" {
+			cfg.DNS.Listen = listen
+		}
+		if upstream != "" {
+			cfg.DNS.Upstream = upstream
+		}
+		// only read to find the wanted entries
+		cfg.Targets.WindowsHosts = false
+		cfg.Targets.DistroHosts = false
+	})
+	if err != nil {
+		return err
+	}
+	defer r.close()
+	r.dnsOnly = true
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			timer.Reset(r.tick())
+		case <-interrupt:
+			return nil
+		}
+	}
+}
+
+// StartDNS starts the DNS responder described by cfg
+func StartDNS(elog service.Logger, cfg *config.Config) (*dnsserver.Server, error) {
+	dns := dnsserver.New(cfg.Suffix(), cfg.DNS.Upstream)
+	err := dns.Start(cfg.DNS.Listen)
+	if err != nil {
+		return nil, err
+	}
+	elog.Info(1, fmt.Sprintf("DNS responder listening on %s", dns.Addr()))
+	return dns, nil
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// planOutput is the JSON form of a plan
+type planOutput struct {
+	Changes []reconcile.Change `json:"changes"`
+	Files   []service.FileDiff `json:"files"`
+}
+
+// PrintPlan prints the changes a run would make as unified
+// diffs, or as JSON, without making them
+func PrintPlan(elog service.Logger, cfg *config.Config, asJSON bool) error {
+	s := service.New(elog, wslapi.Default, cfg)
+	plan, err := s.Plan()
+	if err != nil {
+		return err
+	}
+	diffs, err := s.Preview(plan)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		out := planOutput{Changes: plan.Changes, Files: diffs}
+		if out.Changes == nil {
+			out.Changes = []reconcile.Change{}
+		}
+		if out.Files == nil {
+			out.Files = []service.FileDiff{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("no changes")
+		return nil
+	}
+	for _, d := range diffs {
+		fmt.Print(d.Diff)
+	}
+	return nil
+}
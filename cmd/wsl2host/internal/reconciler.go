@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/control"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/watch"
+	"github.com/shayne/go-wsl2-host/pkg/dnsserver"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// logLines is the number of log lines kept for the control API
+const logLines = 200
+
+// reconciler runs the service logic with the settings of the
+// configuration file when the distros or the settings change
+// It is the control.Daemon of the control API, mu serializing
+// its runs with the API requests
+type reconciler struct {
+	mu       sync.Mutex
+	elog     service.Logger
+	logs     *control.LogBuffer
+	watcher  *config.Watcher
+	override func(*config.Config)
+	cfg      *config.Config
+	svc      *service.Service
+	watch    *watch.Watcher
+	backoff  *watch.Backoff
+	ran      bool // whether the service logic ran since startup
+	dns      *dnsserver.Server
+	control  *control.Server
+
+	// dnsOnly only refreshes the records of the DNS responder,
+	// leaving the hosts files alone
+	dnsOnly bool
+}
+
+// newReconciler loads the configuration file at path, the default
+// one when empty, override adjusting it after every load
+func newReconciler(elog service.Logger, path string, override func(*config.Config)) (*reconciler, error) {
+	if path == "" {
+		var err error
+		path, err = config.DefaultPath()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate configuration: %w", err)
+		}
+	}
+	watcher, err := config.NewWatcher(path)
+	if err != nil {
+		return nil, err
+	}
+	logs := control.NewLogBuffer(elog, logLines)
+	r := &reconciler{elog: logs, logs: logs, watcher: watcher, override: override}
+	r.cfg = r.effective()
+	r.svc = service.New(r.elog, wslapi.Default, r.cfg)
+	r.watch = watch.New(wslapi.Default, r.cfg.Aliases.File, time.Duration(r.cfg.ResyncInterval))
+	r.backoff = &watch.Backoff{Min: time.Duration(r.cfg.PollInterval), Max: time.Duration(r.cfg.MaxPollInterval)}
+	if statepath, err := config.StatePath(); err == nil {
+		r.svc.SetStatePath(statepath)
+	}
+	err = r.startDNS()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// startControl serves the control API, the service running
+// without it when the address is taken
+func (r *reconciler) startControl() {
+	addr, err := control.DefaultAddr()
+	if err == nil {
+		srv := control.New(r)
+		err = srv.Start(addr)
+		if err == nil {
+			r.control = srv
+			return
+		}
+	}
+	r.elog.Warning(1, fmt.Sprintf("control API unavailable: %v", err))
+}
+
+// effective returns the watched configuration with the override
+// applied, leaving the watched one untouched
+func (r *reconciler) effective() *config.Config {
+	cfg := *r.watcher.Config()
+	if r.override != nil {
+		r.override(&cfg)
+	}
+	return &cfg
+}
+
+func (r *reconciler) startDNS() error {
+	if !r.cfg.DNS.Enabled {
+		r.svc.SetDNS(nil)
+		return nil
+	}
+	dns, err := StartDNS(r.elog, r.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to start DNS responder: %w", err)
+	}
+	r.dns = dns
+	r.svc.SetDNS(dns)
+	return nil
+}
+
+// reload applies the changes made to the configuration file,
+// keeping the current settings when it is invalid, and reports
+// whether there were any
+func (r *reconciler) reload() bool {
+	changes, err := r.watcher.Check()
+	if err != nil {
+		r.elog.Error(1, fmt.Sprintf("ignoring configuration change, keeping current settings: %v", err))
+		return false
+	}
+	if len(changes) == 0 {
+		return false
+	}
+	r.elog.Info(1, fmt.Sprintf("configuration %s reloaded: %s", r.watcher.Path(), strings.Join(changes, "; ")))
+
+	old := r.cfg
+	r.cfg = r.effective()
+	r.svc.SetConfig(r.cfg)
+	r.watch.SetAliasFile(r.cfg.Aliases.File)
+	r.watch.SetResync(time.Duration(r.cfg.ResyncInterval))
+	r.backoff.Min = time.Duration(r.cfg.PollInterval)
+	r.backoff.Max = time.Duration(r.cfg.MaxPollInterval)
+	if old.DNS != r.cfg.DNS || old.TLD != r.cfg.TLD {
+		r.closeDNS()
+		err = r.startDNS()
+		if err != nil {
+			r.elog.Error(1, fmt.Sprintf("%v", err))
+		}
+	}
+	return true
+}
+
+// tick reloads the configuration and polls the distros, running
+// the service logic on the first tick and when either changed,
+// and returns the time until the next tick
+func (r *reconciler) tick() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reloaded := r.reload()
+	events, err := r.watch.Poll()
+	if err != nil {
+		r.elog.Error(1, fmt.Sprintf("failed to check distros: %v", err))
+		return r.backoff.Next(true)
+	}
+	changed := reloaded
+	for _, e := range events {
+		if e.Type != watch.Resync {
+			r.elog.Info(1, e.String())
+			changed = true
+		}
+	}
+	if reloaded || len(events) > 0 || !r.ran {
+		// the first run adds the Windows host and removes the
+		// entries of distros no longer running
+		r.run()
+	}
+	return r.backoff.Next(changed)
+}
+
+func (r *reconciler) run() {
+	r.ran = true
+	run := r.svc.Run
+	if r.dnsOnly {
+		run = r.svc.Publish
+	}
+	err := run()
+	if err != nil {
+		r.elog.Error(1, fmt.Sprintf("%v", err))
+	}
+}
+
+// Status returns what the service knows of the distros, when
+// the stopped ones were last seen running included
+func (r *reconciler) Status() (*service.Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, err := r.svc.Status()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]time.Time)
+	for _, info := range r.watch.Distros() {
+		seen[info.Name] = info.LastSeen
+	}
+	for _, d := range st.Distros {
+		if t := seen[d.Name]; d.LastSeen == nil && !t.IsZero() {
+			d.LastSeen = &t
+		}
+	}
+	return st, nil
+}
+
+// Sync reloads the configuration and runs the service logic
+// now, returning its outcome
+func (r *reconciler) Sync() (*service.RunState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reload()
+	r.run()
+	r.backoff.Reset()
+	return r.svc.LastRun(), nil
+}
+
+// SetPaused stops or resumes the updates of a target
+func (r *reconciler) SetPaused(target reconcile.Target, paused bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.svc.SetPaused(target, paused)
+	if err != nil {
+		return err
+	}
+	state := "resumed"
+	if paused {
+		state = "paused"
+	}
+	r.elog.Info(1, fmt.Sprintf("updates of %s %s", target, state))
+	return nil
+}
+
+// Logs returns the last n log lines
+func (r *reconciler) Logs(n int) []control.LogLine {
+	return r.logs.Lines(n)
+}
+
+func (r *reconciler) closeDNS() {
+	if r.dns != nil {
+		r.dns.Close()
+		r.dns = nil
+	}
+}
+
+func (r *reconciler) close() {
+	if r.control != nil {
+		r.control.Close()
+	}
+	r.closeDNS()
+}
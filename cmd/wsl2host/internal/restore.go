@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shayne/go-wsl2-host/pkg/hostsapi"
+)
+
+// RestoreHosts restores the hosts file at path from one of
+// its backups, the most recent one when backup is empty
+func RestoreHosts(path, backup string) error {
+	hapi, err := hostsapi.CreateAPI(path, "")
+	if err != nil {
+		return err
+	}
+	defer hapi.Close()
+
+	if backup == "" {
+		backups, err := hapi.Backups()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			return fmt.Errorf("no backups of %s found", path)
+		}
+		backup = backups[0]
+	}
+
+	err = hapi.Restore(backup)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s from %s\n", path, backup)
+	return nil
+}
@@ -0,0 +1,26 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// ReverseLookup prints the hostnames pointing at ip, the
+// distro's own hostname first
+func ReverseLookup(elog service.Logger, cfg *config.Config, ip string) error {
+	s := service.New(elog, wslapi.Default, cfg)
+	names, err := s.ReverseLookup(ip)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no hostname found for %s", ip)
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
@@ -12,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
 	"golang.org/x/sys/windows/svc"
 	"golang.org/x/sys/windows/svc/debug"
 	"golang.org/x/sys/windows/svc/eventlog"
@@ -25,16 +24,22 @@ type windowserver struct{}
 func (m *windowserver) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
 	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue
 	changes <- svc.Status{State: svc.StartPending}
-	tick := time.Tick(5 * time.Second)
+	rec, err := newReconciler(elog, "", nil)
+	if err != nil {
+		elog.Error(1, fmt.Sprintf("%v", err))
+		return false, 1
+	}
+	defer rec.close()
+	rec.startControl()
+	// the first tick finds every running distro started
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
 loop:
 	for {
 		select {
-		case <-tick:
-			err := service.Run(elog)
-			if err != nil {
-				elog.Error(1, fmt.Sprintf("%v", err))
-			}
+		case <-timer.C:
+			timer.Reset(rec.tick())
 		case c := <-r:
 			switch c.Cmd {
 			case svc.Interrogate:
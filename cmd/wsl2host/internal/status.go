@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// PrintStatus prints the discovered distros, the managed hosts
+// entries and the outcome of the last run, as tables or JSON
+// The running service is asked when reachable, cfg being used
+// to find out otherwise
+func PrintStatus(elog service.Logger, cfg *config.Config, asJSON bool) error {
+	st, err := serviceStatus()
+	if unavailable(err) {
+		st, err = localStatus(elog, cfg)
+	}
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+	writeStatus(os.Stdout, st, time.Now())
+	return nil
+}
+
+func serviceStatus() (*service.Status, error) {
+	c, err := serviceClient()
+	if err != nil {
+		return nil, err
+	}
+	return c.Status()
+}
+
+func localStatus(elog service.Logger, cfg *config.Config) (*service.Status, error) {
+	s := service.New(elog, wslapi.Default, cfg)
+	if path, err := config.StatePath(); err == nil {
+		s.SetStatePath(path)
+	}
+	return s.Status()
+}
+
+func orDash(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ", ")
+}
+
+func writeStatus(out io.Writer, st *service.Status, now time.Time) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DISTRO\tSTATE\tVERSION\tDEFAULT\tIP\tHOSTNAMES\tALIASES\tERROR")
+	for _, d := range st.Distros {
+		def := ""
+		if d.Default {
+			def = "*"
+		}
+		ips := append(append([]string{}, d.IPv4...), d.IPv6...)
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n", d.Name, d.State, d.Version, def,
+			orDash(ips), orDash(d.Hostnames), orDash(d.Aliases), orEmpty(d.Error))
+	}
+	w.Flush()
+	writeDetails(out, st.Distros, now)
+
+	fmt.Fprintf(out, "\nManaged entries of %s:\n", st.HostsPath)
+	if len(st.Managed) == 0 {
+		fmt.Fprintln(out, "none")
+	} else {
+		w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "HOSTNAME\tIP\tIPV6\tCOMMENT")
+		for _, e := range st.Managed {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Hostname, orEmpty(e.IP), orEmpty(e.IPv6), e.Comment)
+		}
+		w.Flush()
+	}
+
+	fmt.Fprintln(out)
+	if len(st.Paused) > 0 {
+		var paused []string
+		for _, target := range st.Paused {
+			paused = append(paused, string(target))
+		}
+		fmt.Fprintf(out, "Paused: %s\n", strings.Join(paused, ", "))
+	}
+	if st.LastRun == nil {
+		fmt.Fprintln(out, "Last run: never")
+		return
+	}
+	ago := now.Sub(st.LastRun.Time).Round(time.Second)
+	fmt.Fprintf(out, "Last run: %s (%s ago), %d changes\n", st.LastRun.Time.Format(time.RFC3339), ago, st.LastRun.Changes)
+	if st.LastRun.Error != "" {
+		fmt.Fprintf(out, "Last error: %s\n", st.LastRun.Error)
+	}
+}
+
+// writeDetails prints what is known of the distros besides their
+// addresses, when anything is
+func writeDetails(out io.Writer, distros []*service.DistroStatus, now time.Time) {
+	var known bool
+	for _, d := range distros {
+		known = known || d.ID != "" || d.Hostname != "" || d.LastSeen != nil
+	}
+	if !known {
+		return
+	}
+	fmt.Fprintln(out)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DISTRO\tID\tHOSTNAME\tUSER\tNETWORKING\tKERNEL\tUPTIME\tLAST SEEN")
+	for _, d := range distros {
+		uptime, seen := "-", "-"
+		if d.BootTime != nil {
+			uptime = now.Sub(*d.BootTime).Round(time.Second).String()
+		}
+		if d.LastSeen != nil {
+			seen = now.Sub(*d.LastSeen).Round(time.Second).String() + " ago"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.Name, orEmpty(d.ID), orEmpty(d.Hostname),
+			orEmpty(d.DefaultUser), orEmpty(d.NetworkingMode), orEmpty(d.Kernel), uptime, seen)
+	}
+	w.Flush()
+}
+
+func orEmpty(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// Sync makes the running service update the hosts files now,
+// waiting for it to finish, and prints the changes it made and
+// its errors, as text or JSON
+// The hosts files are updated with cfg when the service is not
+// running
+func Sync(elog service.Logger, cfg *config.Config, asJSON bool) error {
+	st, err := serviceSync()
+	if unavailable(err) {
+		s := service.New(elog, wslapi.Default, cfg)
+		if path, err := config.StatePath(); err == nil {
+			s.SetStatePath(path)
+		}
+		st, err = localSync(s)
+	}
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(st)
+		if err != nil {
+			return err
+		}
+	} else {
+		writeSync(os.Stdout, st)
+	}
+	return syncError(st)
+}
+
+// writeSync prints the changes made by a run, then those that
+// failed along with their error
+func writeSync(out io.Writer, st *service.RunState) {
+	if len(st.ChangeSet) == 0 {
+		fmt.Fprintln(out, "no changes")
+		return
+	}
+	for _, c := range st.ChangeSet {
+		if c.Error == "" {
+			fmt.Fprintln(out, c.Change)
+		}
+	}
+	failed := st.Failed()
+	if len(failed) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n%d failed:\n", len(failed))
+	for _, c := range failed {
+		fmt.Fprintf(out, "%s: %s\n", c.Change, c.Error)
+	}
+}
+
+func serviceSync() (*service.RunState, error) {
+	c, err := serviceClient()
+	if err != nil {
+		return nil, err
+	}
+	return c.Sync()
+}
+
+// localSync runs s once, the service not running
+func localSync(s *service.Service) (*service.RunState, error) {
+	// the errors are reported through the run state
+	s.Run()
+	return s.LastRun(), nil
+}
+
+// syncError sums up the errors of a run, nil when it succeeded
+func syncError(st *service.RunState) error {
+	var msgs []string
+	if st.Error != "" {
+		msgs = append(msgs, st.Error)
+	}
+	var names []string
+	for name := range st.Distros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		msgs = append(msgs, st.Distros[name])
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopLog struct{}
+
+func (nopLog) Error(eid uint32, msg string) error   { return nil }
+func (nopLog) Warning(eid uint32, msg string) error { return nil }
+func (nopLog) Info(eid uint32, msg string) error    { return nil }
+
+// setDistro records a running distro with the address ip of
+// 172.18.192.0/20 on eth0 and an /etc/hosts without other distros
+func setDistro(r *wslcli.FakeRunner, name, hostname, ip string) {
+	r.SetDiscovery(name, hostname,
+		"Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n"+
+			"eth0\t00C012AC\t00000000\t0001\t0\t0\t0\t00F0FFFF\t0\t0\t0\n",
+		"Local:\n"+
+			"     +-- 172.18.192.0/20 2 0 2\n"+
+			"           |-- "+ip+"\n"+
+			"              /32 host LOCAL\n", "")
+	r.Set("127.0.0.1 localhost\n", "-d", name, "--", "cat", "/etc/hosts")
+}
+
+func TestLocalSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := wslcli.NewFakeRunner()
+	r.SetUTF16("  NAME            STATE           VERSION\r\n"+
+		"* Ubuntu-18.04    Running         2\r\n"+
+		"  Debian          Running         2\r\n", "-l", "-v")
+	setDistro(r, "Ubuntu-18.04", "ubuntu", "172.18.192.5")
+	setDistro(r, "Debian", "debian", "172.18.192.6")
+	r.Set("", "-d", "Debian", "-u", "root", "--", "sed", "-i", "$ a\\172.18.192.5 ubuntu1804.wsl", "/etc/hosts")
+	r.SetError(errors.New("read-only file system"), "-d", "Ubuntu-18.04", "-u", "root", "--", "sed", "-i", "$ a\\172.18.192.6 debian.wsl", "/etc/hosts")
+	wsl := wslapi.New(wslcli.New(r))
+	wsl.SetRegistry(nil)
+	wsl.SetWSLConfig("")
+
+	cfg := config.Default()
+	cfg.HostsPath = filepath.Join(dir, "hosts")
+	cfg.Targets.WindowsHosts = false
+	cfg.WindowsHost = ""
+	cfg.Aliases.File = ""
+	s := service.New(nopLog{}, wsl, cfg)
+	s.SetStatePath(filepath.Join(dir, "state.json"))
+
+	st, err := localSync(s)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, st.Changes)
+	assert.Len(t, st.ChangeSet, 2)
+
+	var out bytes.Buffer
+	writeSync(&out, st)
+	assert.Equal(t, "distro-hosts[Debian]: add ubuntu1804.wsl 172.18.192.5\n"+
+		"\n"+
+		"1 failed:\n"+
+		"distro-hosts[Ubuntu-18.04]: add debian.wsl 172.18.192.6: read-only file system\n", out.String())
+	assert.EqualError(t, syncError(st), "read-only file system")
+
+	// recorded for status
+	saved, err := service.LoadRunState(filepath.Join(dir, "state.json"))
+	assert.Nil(t, err)
+	if assert.NotNil(t, saved) {
+		assert.Equal(t, st.ChangeSet, saved.ChangeSet)
+	}
+
+	out.Reset()
+	writeSync(&out, &service.RunState{})
+	assert.Equal(t, "no changes\n", out.String())
+}
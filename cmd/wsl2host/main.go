@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/shayne/go-wsl2-host/cmd/wsl2host/internal"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
 	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
 	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/debug"
 	"golang.org/x/sys/windows/svc/eventlog"
 )
 
@@ -18,11 +21,35 @@ func usage(errmsg string) {
 			"usage: %s <command>\n"+
 			"       where <command> is one of\n"+
 			"       install, remove, debug, start, stop, pause or continue.\n"+
-			"       run: One-time run and update.\n",
+			"       run: One-time run and update.\n"+
+			"       sync [-json]: Make the running service update the hosts files now and print the changes made,\n"+
+			"                     doing a one-time run when the service is not running.\n"+
+			"       restore [backup]: Restore the hosts file from a backup, the latest by default.\n"+
+			"       dns [addr [upstream]]: Run in the console answering DNS queries on addr (default from the configuration),\n"+
+			"                              forwarding other queries to upstream when given, without updating the hosts files.\n"+
+			"       reverse <ip>: Print the hostnames of a distro IP address.\n"+
+			"       config validate [path]: Check a configuration file, the one the service uses by default.\n"+
+			"       collisions: Print the hostnames claimed more than once and how they are settled.\n"+
+			"       plan [-json]: Print the changes a run would make to the hosts files, without making them.\n"+
+			"       status [-json]: Print the distros, the managed hosts entries and the outcome of the last run,\n"+
+			"                       as known to the running service when reachable.\n"+
+			"       target pause|resume <target>: Stop or resume the updates of windows-hosts or distro-hosts\n"+
+			"                                     by the running service.\n"+
+			"       logs [n]: Print the last n lines logged by the running service, 50 by default.\n",
 		errmsg, os.Args[0])
 	os.Exit(2)
 }
 
+// loadConfig loads the configuration of the service, exiting
+// when it is invalid
+func loadConfig() *config.Config {
+	cfg, err := internal.LoadConfig("")
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+	return cfg
+}
+
 func main() {
 	const svcName = "wsl2host"
 
@@ -57,11 +84,66 @@ func main() {
 	case "continue":
 		err = internal.ControlService(svcName, svc.Continue, svc.Running)
 	case "run":
-		elog, err := eventlog.Open(svcName)
+		var elog *eventlog.Log
+		elog, err = eventlog.Open(svcName)
 		if err != nil {
 			return
 		}
-		err = service.Run(elog)
+		err = service.Run(elog, loadConfig())
+	case "sync":
+		asJSON := len(os.Args) > 2 && strings.TrimLeft(os.Args[2], "-") == "json"
+		err = internal.Sync(debug.New(svcName), loadConfig(), asJSON)
+	case "restore":
+		var backup string
+		if len(os.Args) > 2 {
+			backup = os.Args[2]
+		}
+		err = internal.RestoreHosts(loadConfig().HostsPath, backup)
+	case "dns":
+		var addr, upstream string
+		if len(os.Args) > 2 {
+			addr = os.Args[2]
+		}
+		if len(os.Args) > 3 {
+			upstream = os.Args[3]
+		}
+		err = internal.RunDNS(debug.New(svcName), addr, upstream)
+	case "reverse":
+		if len(os.Args) < 3 {
+			usage("no IP address specified")
+		}
+		err = internal.ReverseLookup(debug.New(svcName), loadConfig(), os.Args[2])
+	case "plan":
+		asJSON := len(os.Args) > 2 && strings.TrimLeft(os.Args[2], "-") == "json"
+		err = internal.PrintPlan(debug.New(svcName), loadConfig(), asJSON)
+	case "status":
+		asJSON := len(os.Args) > 2 && strings.TrimLeft(os.Args[2], "-") == "json"
+		err = internal.PrintStatus(debug.New(svcName), loadConfig(), asJSON)
+	case "target":
+		if len(os.Args) < 4 || (os.Args[2] != "pause" && os.Args[2] != "resume") {
+			usage("usage: target pause|resume <target>")
+		}
+		err = internal.SetTargetPaused(os.Args[3], os.Args[2] == "pause")
+	case "logs":
+		n := 50
+		if len(os.Args) > 2 {
+			n, err = strconv.Atoi(os.Args[2])
+			if err != nil || n < 0 {
+				usage(fmt.Sprintf("invalid line count %s", os.Args[2]))
+			}
+		}
+		err = internal.PrintLogs(n)
+	case "collisions":
+		err = internal.ListCollisions(debug.New(svcName), loadConfig())
+	case "config":
+		if len(os.Args) < 3 || strings.ToLower(os.Args[2]) != "validate" {
+			usage("usage: config validate [path]")
+		}
+		var path string
+		if len(os.Args) > 3 {
+			path = os.Args[3]
+		}
+		err = internal.ValidateConfig(path)
 	default:
 		usage(fmt.Sprintf("invalid command %s", cmd))
 	}
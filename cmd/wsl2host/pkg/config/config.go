@@ -0,0 +1,349 @@
+// Package config loads the wsl2host configuration file
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/internal/naming"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+)
+
+// FileName is the name of the configuration file
+const FileName = "config.json"
+
+// StateFileName is the name of the file recording the last run
+const StateFileName = "state.json"
+
+// Duration is a time.Duration read from strings such as "5s"
+type Duration time.Duration
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return fmt.Errorf("duration must be a string such as \"5s\": %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Aliases configures where the aliases of the default distro
+// come from
+type Aliases struct {
+	// File in the default distro listing space separated aliases,
+	// empty to not read any
+	File string `json:"file"`
+	// Static aliases always pointing at the default distro
+	Static []string `json:"static"`
+}
+
+// Names configures the hostnames given to distros, templates
+// being text/template executed with a naming.Distro
+type Names struct {
+	// Templates produce the hostnames of every distro
+	Templates []string `json:"templates"`
+	// Distros replaces the templates of the named distros
+	Distros map[string][]string `json:"distros"`
+	// Collisions is the naming.Policy settling hostnames claimed
+	// more than once
+	Collisions string `json:"collisions"`
+}
+
+// Addresses configures how the IPv4 address of a distro is
+// picked among the addresses of its interfaces
+type Addresses struct {
+	// Interfaces are path.Match patterns of interface names in
+	// order of preference, any interface when empty
+	Interfaces []string `json:"interfaces"`
+	// Subnets in CIDR notation the address must be in, any
+	// when empty
+	Subnets []string `json:"subnets"`
+	// DefaultRoute prefers the interfaces of the default route
+	DefaultRoute bool `json:"default_route"`
+}
+
+// Targets configures what gets updated
+type Targets struct {
+	// WindowsHosts updates the Windows hosts file
+	WindowsHosts bool `json:"windows_hosts"`
+	// DistroHosts updates the /etc/hosts of each running distro
+	DistroHosts bool `json:"distro_hosts"`
+}
+
+// DNS configures the built-in DNS responder
+type DNS struct {
+	Enabled bool `json:"enabled"`
+	// Listen is the address to answer queries on
+	Listen string `json:"listen"`
+	// Upstream is the server other queries are forwarded to,
+	// refused when empty
+	Upstream string `json:"upstream"`
+}
+
+// Config is the configuration of the service
+type Config struct {
+	// TLD is appended to distro names to form their hostname
+	TLD string `json:"tld"`
+	// WindowsHost is the name of the Windows host in the
+	// /etc/hosts of the distros
+	WindowsHost string `json:"windows_host"`
+	// Filter names the block of managed entries in the hosts file
+	Filter string `json:"filter"`
+	// HostsPath is the Windows hosts file
+	HostsPath string `json:"hosts_path"`
+	// Backups is the number of hosts file backups kept
+	Backups int `json:"backups"`
+	// PreserveOrder keeps existing hosts entries in place
+	PreserveOrder bool `json:"preserve_order"`
+	// PollInterval is the time between two checks for changes
+	// of the distros
+	PollInterval Duration `json:"poll_interval"`
+	// MaxPollInterval is what the time between two checks grows
+	// to while nothing changes, 15s or PollInterval when longer
+	// by default
+	MaxPollInterval Duration `json:"max_poll_interval"`
+	// ResyncInterval is the time between two full updates, 1m or
+	// PollInterval when longer by default
+	ResyncInterval Duration `json:"resync_interval"`
+	// ExcludeDistros lists prefixes of distro names to ignore
+	ExcludeDistros []string `json:"exclude_distros"`
+	// DistroSource is where the distros are listed from, "cli"
+	// or "registry"
+	DistroSource string    `json:"distro_source"`
+	Addresses    Addresses `json:"addresses"`
+	Names        Names     `json:"names"`
+	Aliases      Aliases   `json:"aliases"`
+	Targets      Targets   `json:"targets"`
+	DNS          DNS       `json:"dns"`
+}
+
+// Default returns the configuration used when there is
+// no configuration file
+func Default() *Config {
+	return &Config{
+		TLD:             "wsl",
+		WindowsHost:     "windows.local",
+		Filter:          "wsl2-host",
+		HostsPath:       "C:/Windows/System32/drivers/etc/hosts",
+		Backups:         5,
+		PollInterval:    Duration(5 * time.Second),
+		MaxPollInterval: Duration(15 * time.Second),
+		ResyncInterval:  Duration(time.Minute),
+		ExcludeDistros:  []string{"docker-desktop"},
+		DistroSource:    string(wslapi.CLISource),
+		Addresses: Addresses{
+			DefaultRoute: true,
+		},
+		Names: Names{
+			Templates:  []string{naming.DefaultTemplate},
+			Collisions: string(naming.Error),
+		},
+		Aliases: Aliases{
+			File: "~/.wsl2hosts",
+		},
+		Targets: Targets{
+			WindowsHosts: true,
+			DistroHosts:  true,
+		},
+		DNS: DNS{
+			Listen: "127.0.0.1:53",
+		},
+	}
+}
+
+// Dir returns the wsl2host directory in the configuration
+// directory of the user running the service
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wsl2host"), nil
+}
+
+// DefaultPath returns the location of the configuration file
+func DefaultPath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// StatePath returns the location of the file the service
+// records the outcome of its last run in
+func StatePath() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, StateFileName), nil
+}
+
+// pollDefault returns d, or def when not set but no less than
+// poll
+func pollDefault(d, def, poll Duration) Duration {
+	switch {
+	case d != 0:
+		return d
+	case def < poll:
+		return poll
+	}
+	return def
+}
+
+// Parse reads a configuration, fields missing from it keep
+// their default value
+func Parse(data []byte) (*Config, error) {
+	c := Default()
+	// defaulted once poll_interval is known
+	c.MaxPollInterval, c.ResyncInterval = 0, 0
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(c)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	def := Default()
+	c.MaxPollInterval = pollDefault(c.MaxPollInterval, def.MaxPollInterval, c.PollInterval)
+	c.ResyncInterval = pollDefault(c.ResyncInterval, def.ResyncInterval, c.PollInterval)
+	err = c.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load reads the configuration file at path, returning the
+// default configuration when it does not exist
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Default(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// validHostname reports whether name is a RFC 1123 hostname
+func validHostname(name string) bool {
+	return naming.ValidHostname(name) == nil
+}
+
+func validHostPort(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" {
+		return false
+	}
+	return host == "" || net.ParseIP(host) != nil
+}
+
+// Validate checks the configuration, reporting all problems
+func (c *Config) Validate() error {
+	var errs []string
+	if !validHostname(strings.TrimPrefix(c.TLD, ".")) {
+		errs = append(errs, fmt.Sprintf("tld: invalid domain %q", c.TLD))
+	}
+	if c.WindowsHost != "" && !validHostname(c.WindowsHost) {
+		errs = append(errs, fmt.Sprintf("windows_host: invalid hostname %q", c.WindowsHost))
+	}
+	if strings.TrimSpace(c.Filter) == "" {
+		errs = append(errs, "filter: must not be empty")
+	}
+	if c.HostsPath == "" {
+		errs = append(errs, "hosts_path: must not be empty")
+	}
+	if c.Backups < 0 {
+		errs = append(errs, "backups: must not be negative")
+	}
+	if time.Duration(c.PollInterval) < time.Second {
+		errs = append(errs, "poll_interval: must be at least 1s")
+	}
+	if c.MaxPollInterval < c.PollInterval {
+		errs = append(errs, "max_poll_interval: must not be less than poll_interval")
+	}
+	if c.ResyncInterval < c.PollInterval {
+		errs = append(errs, "resync_interval: must not be less than poll_interval")
+	}
+	for _, d := range c.ExcludeDistros {
+		if strings.TrimSpace(d) == "" {
+			errs = append(errs, "exclude_distros: must not contain empty names")
+		}
+	}
+	_, err := wslapi.ParseSource(c.DistroSource)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("distro_source: %v", err))
+	}
+	_, err = c.Selection()
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("addresses: %v", err))
+	}
+	_, err = c.Namer()
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("names: %v", err))
+	}
+	_, err = naming.ParsePolicy(c.Names.Collisions)
+	if err != nil {
+		errs = append(errs, fmt.Sprintf("names.collisions: %v", err))
+	}
+	for _, a := range c.Aliases.Static {
+		if !validHostname(a) {
+			errs = append(errs, fmt.Sprintf("aliases.static: invalid hostname %q", a))
+		}
+	}
+	if c.DNS.Enabled && !validHostPort(c.DNS.Listen) {
+		errs = append(errs, fmt.Sprintf("dns.listen: invalid address %q", c.DNS.Listen))
+	}
+	if c.DNS.Upstream != "" && !validHostPort(c.DNS.Upstream) {
+		errs = append(errs, fmt.Sprintf("dns.upstream: invalid address %q", c.DNS.Upstream))
+	}
+	if !c.Targets.WindowsHosts && !c.Targets.DistroHosts && !c.DNS.Enabled {
+		errs = append(errs, "targets: nothing to update, enable a target or dns")
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Selection returns the wslcli.Selection of the configured
+// addresses
+func (c *Config) Selection() (wslcli.Selection, error) {
+	return wslcli.ParseSelection(c.Addresses.Interfaces, c.Addresses.Subnets, c.Addresses.DefaultRoute)
+}
+
+// Namer returns the naming.Namer of the configured templates
+func (c *Config) Namer() (*naming.Namer, error) {
+	return naming.New(c.TLD, c.Names.Templates, c.Names.Distros)
+}
+
+// Suffix returns the TLD as appended to hostnames, e.g. ".wsl"
+func (c *Config) Suffix() string {
+	return "." + strings.Trim(c.TLD, ".")
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefault(t *testing.T) {
+	c := Default()
+	assert.Nil(t, c.Validate())
+	assert.Equal(t, ".wsl", c.Suffix())
+	assert.Equal(t, Duration(5*time.Second), c.PollInterval)
+	assert.True(t, c.Targets.WindowsHosts)
+	assert.True(t, c.Targets.DistroHosts)
+	assert.False(t, c.DNS.Enabled)
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load("testdata/config.json")
+	assert.Nil(t, err)
+	assert.Equal(t, Duration(10*time.Second), c.PollInterval)
+	assert.Equal(t, Duration(2*time.Minute), c.MaxPollInterval)
+	assert.Equal(t, []string{"docker-desktop", "rancher-desktop"}, c.ExcludeDistros)
+	assert.Equal(t, "registry", c.DistroSource)
+	assert.Equal(t, Addresses{Interfaces: []string{"eth*", "docker0"}, Subnets: []string{"172.16.0.0/12"}}, c.Addresses)
+	assert.Equal(t, []string{"app.local"}, c.Aliases.Static)
+	assert.True(t, c.Targets.WindowsHosts)
+	assert.False(t, c.Targets.DistroHosts)
+	assert.True(t, c.DNS.Enabled)
+	assert.Equal(t, "1.1.1.1:53", c.DNS.Upstream)
+}
+
+func TestLoadMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := Load(filepath.Join(dir, FileName))
+	assert.Nil(t, err)
+	assert.Equal(t, Default(), c)
+}
+
+func TestParsePartial(t *testing.T) {
+	c, err := Parse([]byte(`{"tld": "local", "targets": {"distro_hosts": false}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, ".local", c.Suffix())
+	assert.True(t, c.Targets.WindowsHosts)
+	assert.False(t, c.Targets.DistroHosts)
+	assert.Equal(t, "wsl2-host", c.Filter)
+}
+
+func TestParsePollInterval(t *testing.T) {
+	c, err := Parse([]byte(`{"poll_interval": "2m"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, Duration(2*time.Minute), c.PollInterval)
+	assert.Equal(t, Duration(2*time.Minute), c.MaxPollInterval)
+	assert.Equal(t, Duration(2*time.Minute), c.ResyncInterval)
+
+	c, err = Parse([]byte(`{"poll_interval": "10s"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, Duration(15*time.Second), c.MaxPollInterval)
+	assert.Equal(t, Duration(time.Minute), c.ResyncInterval)
+
+	c, err = Parse([]byte(`{"poll_interval": "30s"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, Duration(30*time.Second), c.MaxPollInterval)
+	assert.Equal(t, Duration(time.Minute), c.ResyncInterval)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"syntax":         `{"tld": }`,
+		"unknown field":  `{"tdl": "wsl"}`,
+		"tld":            `{"tld": "not valid"}`,
+		"windows host":   `{"windows_host": "-windows"}`,
+		"filter":         `{"filter": " "}`,
+		"backups":        `{"backups": -1}`,
+		"poll interval":  `{"poll_interval": "10ms"}`,
+		"duration":       `{"poll_interval": 5}`,
+		"max poll":       `{"poll_interval": "10s", "max_poll_interval": "5s"}`,
+		"resync":         `{"poll_interval": "10s", "resync_interval": "5s"}`,
+		"static alias":   `{"aliases": {"static": ["a_b"]}}`,
+		"dns listen":     `{"dns": {"enabled": true, "listen": "localhost"}}`,
+		"dns upstream":   `{"dns": {"upstream": "1.1.1.1"}}`,
+		"nothing to do":  `{"targets": {"windows_hosts": false, "distro_hosts": false}}`,
+		"empty excluded": `{"exclude_distros": [""]}`,
+		"distro source":  `{"distro_source": "wmi"}`,
+		"interfaces":     `{"addresses": {"interfaces": ["eth["]}}`,
+		"subnets":        `{"addresses": {"subnets": ["172.16.0.0"]}}`,
+		"template":       `{"names": {"templates": ["{{.Name"]}}`,
+		"no templates":   `{"names": {"templates": []}}`,
+		"override":       `{"names": {"distros": {"Debian": ["{{nope}}"]}}}`,
+		"collisions":     `{"names": {"collisions": "last-wins"}}`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse([]byte(data))
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestValidateReportsAll(t *testing.T) {
+	c := Default()
+	c.TLD = ""
+	c.Backups = -1
+	err := c.Validate()
+	assert.EqualError(t, err, `invalid configuration: tld: invalid domain ""; backups: must not be negative`)
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Watcher reloads the configuration file when it changes,
+// keeping the last valid configuration when it becomes invalid
+type Watcher struct {
+	path    string
+	current *Config
+	modtime time.Time
+	size    int64
+}
+
+// NewWatcher loads the configuration file at path and
+// watches it for changes
+func NewWatcher(path string) (*Watcher, error) {
+	w := &Watcher{path: path}
+	w.modtime, w.size = w.stat()
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	w.current = c
+	return w, nil
+}
+
+// Path returns the watched file
+func (w *Watcher) Path() string {
+	return w.path
+}
+
+// Config returns the configuration in effect
+func (w *Watcher) Config() *Config {
+	return w.current
+}
+
+func (w *Watcher) stat() (time.Time, int64) {
+	fi, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, -1
+	}
+	return fi.ModTime(), fi.Size()
+}
+
+// Check reloads the configuration when the file changed since
+// the last call, returning the changed settings
+// An invalid file is reported once and the configuration in
+// effect is kept until the file changes again
+func (w *Watcher) Check() ([]string, error) {
+	modtime, size := w.stat()
+	if modtime.Equal(w.modtime) && size == w.size {
+		return nil, nil
+	}
+	w.modtime, w.size = modtime, size
+	c, err := Load(w.path)
+	if err != nil {
+		return nil, err
+	}
+	changes := Diff(w.current, c)
+	w.current = c
+	return changes, nil
+}
+
+// flatten turns the JSON form of a configuration into
+// "dns.listen" style keys
+func flatten(prefix string, v interface{}, out map[string]string) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, sub := range m {
+			flatten(prefix+k+".", sub, out)
+		}
+		return
+	}
+	b, _ := json.Marshal(v)
+	out[prefix[:len(prefix)-1]] = string(b)
+}
+
+func settings(c *Config) map[string]string {
+	b, _ := json.Marshal(c)
+	var v interface{}
+	json.Unmarshal(b, &v)
+	out := make(map[string]string)
+	flatten("", v, out)
+	return out
+}
+
+// Diff describes the settings that differ between two
+// configurations, e.g. `poll_interval: "5s" -> "10s"`
+func Diff(old, new *Config) []string {
+	before := settings(old)
+	after := settings(new)
+	var changes []string
+	for k, v := range after {
+		if before[k] != v {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", k, before[k], v))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, path, data string, mtime time.Time) {
+	err := ioutil.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(path, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, FileName)
+	mtime := time.Now().Add(-time.Hour)
+
+	w, err := NewWatcher(path)
+	assert.Nil(t, err)
+	assert.Equal(t, Default(), w.Config())
+
+	changes, err := w.Check()
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+
+	writeConfig(t, path, `{"poll_interval": "10s", "exclude_distros": []}`, mtime)
+	changes, err = w.Check()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`exclude_distros: ["docker-desktop"] -> []`,
+		`poll_interval: "5s" -> "10s"`,
+	}, changes)
+	assert.Equal(t, Duration(10*time.Second), w.Config().PollInterval)
+
+	// invalid files are reported once, the last good settings stay
+	writeConfig(t, path, `{"poll_interval": "1ms"}`, mtime.Add(time.Minute))
+	_, err = w.Check()
+	assert.NotNil(t, err)
+	changes, err = w.Check()
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, Duration(10*time.Second), w.Config().PollInterval)
+
+	writeConfig(t, path, `{"tld": "dev", "dns": {"enabled": true}}`, mtime.Add(2*time.Minute))
+	changes, err = w.Check()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`dns.enabled: false -> true`,
+		`exclude_distros: [] -> ["docker-desktop"]`,
+		`poll_interval: "10s" -> "5s"`,
+		`tld: "wsl" -> "dev"`,
+	}, changes)
+
+	// removing the file goes back to the defaults
+	os.Remove(path)
+	changes, err = w.Check()
+	assert.Nil(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, Default(), w.Config())
+}
+
+func TestNewWatcherInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, FileName)
+	writeConfig(t, path, `{"tld": ""}`, time.Now())
+	_, err = NewWatcher(path)
+	assert.NotNil(t, err)
+}
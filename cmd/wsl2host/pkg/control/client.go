@@ -0,0 +1,121 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+)
+
+// ErrUnavailable is returned by the Client when nothing listens
+// on the address, the service not running
+var ErrUnavailable = errors.New("service is not running")
+
+// dialTimeout bounds the wait for a busy pipe or socket
+const dialTimeout = 2 * time.Second
+
+// Client calls the API of the service listening on an address
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a Client for the service listening on addr
+func NewClient(addr string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+			defer cancel()
+			conn, err := dial(ctx, addr)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+			}
+			return conn, nil
+		},
+		DisableKeepAlives: true,
+	}
+	return &Client{http: &http.Client{Transport: transport}}
+}
+
+// do sends a request to the service, decoding the JSON response
+// into out unless nil
+func (c *Client) do(method, path string, out interface{}) error {
+	// the host is ignored, the transport dials the address
+	req, err := http.NewRequest(method, "http://wsl2host"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var aerr apiError
+		if json.NewDecoder(resp.Body).Decode(&aerr) != nil || aerr.Error == "" {
+			return fmt.Errorf("service answered %s", resp.Status)
+		}
+		return errors.New(aerr.Error)
+	}
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// Status returns what the service knows of the distros
+func (c *Client) Status() (*service.Status, error) {
+	st := &service.Status{}
+	err := c.do(http.MethodGet, "/v1/status", st)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Sync makes the service update the hosts files now, returning
+// the outcome
+func (c *Client) Sync() (*service.RunState, error) {
+	st := &service.RunState{}
+	err := c.do(http.MethodPost, "/v1/sync", st)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// SetPaused stops or resumes the updates of a target
+func (c *Client) SetPaused(target reconcile.Target, paused bool) error {
+	action := "resume"
+	if paused {
+		action = "pause"
+	}
+	return c.do(http.MethodPost, "/v1/targets/"+url.PathEscape(string(target))+"/"+action, nil)
+}
+
+// Logs returns the last n lines logged by the service
+func (c *Client) Logs(n int) ([]LogLine, error) {
+	var lines []LogLine
+	err := c.do(http.MethodGet, fmt.Sprintf("/v1/logs?n=%d", n), &lines)
+	if err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
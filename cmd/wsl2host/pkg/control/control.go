@@ -0,0 +1,193 @@
+// Package control provides the local API of the running service,
+// served over a named pipe on Windows and a Unix socket elsewhere
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+)
+
+// defaultLogLines is the number of log lines returned when the
+// request does not say
+const defaultLogLines = 50
+
+// Daemon is what the running service exposes through the API,
+// its methods may be called concurrently
+type Daemon interface {
+	// Status returns what the service knows of the distros
+	Status() (*service.Status, error)
+	// Sync updates the hosts files now, returning the outcome
+	Sync() (*service.RunState, error)
+	// SetPaused stops or resumes the updates of a target
+	SetPaused(target reconcile.Target, paused bool) error
+	// Logs returns the last n log lines, oldest first
+	Logs(n int) []LogLine
+}
+
+// apiError is the body of failed requests
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Server serves the API of a Daemon
+type Server struct {
+	daemon Daemon
+	mux    *http.ServeMux
+
+	mu  sync.Mutex
+	srv *http.Server
+	l   net.Listener
+	wg  sync.WaitGroup
+}
+
+// New creates a Server for daemon
+func New(daemon Daemon) *Server {
+	s := &Server{daemon: daemon, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/v1/status", s.handleStatus)
+	s.mux.HandleFunc("/v1/sync", s.handleSync)
+	s.mux.HandleFunc("/v1/targets/", s.handleTarget)
+	s.mux.HandleFunc("/v1/logs", s.handleLogs)
+	return s
+}
+
+// ServeHTTP answers a single API request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Start listens on addr, a pipe name on Windows and a socket
+// path elsewhere, and serves the API until Close
+func (s *Server) Start(addr string) error {
+	l, err := listen(addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	s.mu.Lock()
+	s.l = l
+	s.srv = srv
+	s.mu.Unlock()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		srv.Serve(l)
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.l == nil {
+		return nil
+	}
+	return s.l.Addr()
+}
+
+// Close stops the listener started with Start
+func (s *Server) Close() error {
+	s.mu.Lock()
+	srv := s.srv
+	s.srv = nil
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	err := srv.Close()
+	s.wg.Wait()
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, apiError{Error: err.Error()})
+}
+
+// allow answers 405 unless the request uses method
+func allow(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	st, err := s.daemon.Status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+	st, err := s.daemon.Sync()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// handleTarget serves /v1/targets/<target>/pause and
+// /v1/targets/<target>/resume
+func (s *Server) handleTarget(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/targets/"), "/")
+	if len(parts) != 2 || (parts[1] != "pause" && parts[1] != "resume") {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if !allow(w, r, http.MethodPost) {
+		return
+	}
+	err := s.daemon.SetPaused(reconcile.Target(parts[0]), parts[1] == "pause")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if !allow(w, r, http.MethodGet) {
+		return
+	}
+	n := defaultLogLines
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid line count %q", v))
+			return
+		}
+	}
+	lines := s.daemon.Logs(n)
+	if lines == nil {
+		lines = []LogLine{}
+	}
+	writeJSON(w, http.StatusOK, lines)
+}
@@ -0,0 +1,179 @@
+package control
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeDaemon struct {
+	paused map[reconcile.Target]bool
+	syncs  int
+	logs   []LogLine
+}
+
+func (d *fakeDaemon) Status() (*service.Status, error) {
+	st := &service.Status{
+		Distros:   []*service.DistroStatus{{Name: "Ubuntu", State: "Running", Version: 2, Default: true}},
+		HostsPath: `C:\Windows\System32\drivers\etc\hosts`,
+		Managed:   []reconcile.Entry{{Hostname: "ubuntu.wsl", IP: "172.18.192.5"}},
+	}
+	for target, paused := range d.paused {
+		if paused {
+			st.Paused = append(st.Paused, target)
+		}
+	}
+	return st, nil
+}
+
+func (d *fakeDaemon) Sync() (*service.RunState, error) {
+	d.syncs++
+	return &service.RunState{Time: time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC), Changes: 2}, nil
+}
+
+func (d *fakeDaemon) SetPaused(target reconcile.Target, paused bool) error {
+	if target != reconcile.WindowsHosts && target != reconcile.DistroHosts {
+		return errors.New("unknown target")
+	}
+	d.paused[target] = paused
+	return nil
+}
+
+func (d *fakeDaemon) Logs(n int) []LogLine {
+	if n < len(d.logs) {
+		return d.logs[len(d.logs)-n:]
+	}
+	return d.logs
+}
+
+// testAddr returns an address only used by the test
+func testAddr(t *testing.T) string {
+	if runtime.GOOS == "windows" {
+		return `\\.\pipe\wsl2host-test`
+	}
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "run", "wsl2host.sock")
+}
+
+func TestServer(t *testing.T) {
+	d := &fakeDaemon{
+		paused: make(map[reconcile.Target]bool),
+		logs: []LogLine{
+			{Level: "info", Message: "one"},
+			{Level: "error", Message: "two"},
+			{Level: "info", Message: "three"},
+		},
+	}
+	addr := testAddr(t)
+	s := New(d)
+	err := s.Start(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assert.Equal(t, addr, s.Addr().String())
+
+	// a second service cannot take the address
+	err = New(d).Start(addr)
+	assert.NotNil(t, err)
+
+	c := NewClient(addr)
+	st, err := c.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, "Ubuntu", st.Distros[0].Name)
+	assert.Equal(t, []reconcile.Entry{{Hostname: "ubuntu.wsl", IP: "172.18.192.5"}}, st.Managed)
+
+	rs, err := c.Sync()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, rs.Changes)
+	assert.Equal(t, 1, d.syncs)
+
+	err = c.SetPaused(reconcile.DistroHosts, true)
+	assert.Nil(t, err)
+	st, err = c.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, []reconcile.Target{reconcile.DistroHosts}, st.Paused)
+	err = c.SetPaused(reconcile.DistroHosts, false)
+	assert.Nil(t, err)
+	assert.False(t, d.paused[reconcile.DistroHosts])
+
+	err = c.SetPaused("nowhere", true)
+	assert.EqualError(t, err, "unknown target")
+
+	lines, err := c.Logs(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []LogLine{{Level: "error", Message: "two"}, {Level: "info", Message: "three"}}, lines)
+
+	err = s.Close()
+	assert.Nil(t, err)
+	_, err = c.Status()
+	assert.True(t, errors.Is(err, ErrUnavailable), "got %v", err)
+}
+
+func TestServerMethods(t *testing.T) {
+	s := New(&fakeDaemon{paused: make(map[reconcile.Target]bool)})
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodPost, "/v1/status", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/sync", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/v1/targets/windows-hosts/pause", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/v1/targets/windows-hosts/stop", http.StatusNotFound},
+		{http.MethodPost, "/v1/targets/windows-hosts/pause", http.StatusNoContent},
+		{http.MethodGet, "/v1/logs?n=-1", http.StatusBadRequest},
+		{http.MethodGet, "/v1/logs?n=3", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, tc.code, w.Code, "%s %s", tc.method, tc.path)
+	}
+}
+
+func TestClientUnavailable(t *testing.T) {
+	_, err := NewClient(testAddr(t)).Status()
+	assert.True(t, errors.Is(err, ErrUnavailable), "got %v", err)
+}
+
+type nopLog struct{}
+
+func (nopLog) Error(eid uint32, msg string) error   { return nil }
+func (nopLog) Warning(eid uint32, msg string) error { return nil }
+func (nopLog) Info(eid uint32, msg string) error    { return nil }
+
+func TestLogBuffer(t *testing.T) {
+	b := NewLogBuffer(nopLog{}, 3)
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	assert.Empty(t, b.Lines(10))
+
+	b.Info(1, "one")
+	b.Warning(1, "two")
+	assert.Equal(t, []LogLine{
+		{Time: now, Level: "info", Message: "one"},
+		{Time: now, Level: "warning", Message: "two"},
+	}, b.Lines(10))
+
+	b.Error(1, "three")
+	b.Info(1, "four")
+	assert.Equal(t, []LogLine{
+		{Time: now, Level: "warning", Message: "two"},
+		{Time: now, Level: "error", Message: "three"},
+		{Time: now, Level: "info", Message: "four"},
+	}, b.Lines(10))
+	assert.Equal(t, []LogLine{{Time: now, Level: "info", Message: "four"}}, b.Lines(1))
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+// +build !windows
+
+package control
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+)
+
+// DefaultAddr returns the socket the service listens on, next
+// to the configuration file
+func DefaultAddr() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wsl2host.sock"), nil
+}
+
+// listen creates the socket at path, only its owner being
+// allowed to connect
+// A socket left behind by a service that is gone is replaced
+func listen(path string) (net.Listener, error) {
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return nil, errors.New("already in use")
+	}
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to restrict access: %w", err)
+	}
+	return l, nil
+}
+
+func dial(ctx context.Context, path string) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", path)
+}
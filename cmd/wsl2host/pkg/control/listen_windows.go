@@ -0,0 +1,32 @@
+//go:build windows
+// +build windows
+
+package control
+
+import (
+	"context"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// DefaultAddr returns the named pipe the service listens on
+func DefaultAddr() (string, error) {
+	return `\\.\pipe\wsl2host`, nil
+}
+
+// pipeSecurity only lets local system and administrators connect,
+// denying network logons so remote clients are rejected
+const pipeSecurity = "D:P(D;;GA;;;NU)(A;;GA;;;SY)(A;;GA;;;BA)"
+
+// listen creates the named pipe, failing when another process
+// already serves it
+func listen(name string) (net.Listener, error) {
+	return winio.ListenPipe(name, &winio.PipeConfig{SecurityDescriptor: pipeSecurity})
+}
+
+// dial connects to the named pipe, waiting while all its
+// instances are busy
+func dial(ctx context.Context, name string) (net.Conn, error) {
+	return winio.DialPipeContext(ctx, name)
+}
@@ -0,0 +1,44 @@
+//go:build windows
+// +build windows
+
+package control
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenPipe(t *testing.T) {
+	addr := testAddr(t)
+	l, err := listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// served by a single process
+	_, err = listen(addr)
+	assert.NotNil(t, err)
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dial(ctx, addr)
+	if assert.Nil(t, err) {
+		conn.Close()
+	}
+	assert.Nil(t, <-accepted)
+
+	assert.Nil(t, l.Close())
+	_, err = dial(ctx, addr)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,79 @@
+package control
+
+import (
+	"sync"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/service"
+)
+
+// LogLine is a message logged by the service
+type LogLine struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// LogBuffer is a service.Logger keeping the last lines it logs
+// before handing them to the wrapped logger
+type LogBuffer struct {
+	elog service.Logger
+	now  func() time.Time
+
+	mu    sync.Mutex
+	lines []LogLine
+	next  int
+	full  bool
+}
+
+// NewLogBuffer creates a LogBuffer logging to elog and keeping
+// up to size lines
+func NewLogBuffer(elog service.Logger, size int) *LogBuffer {
+	return &LogBuffer{elog: elog, now: time.Now, lines: make([]LogLine, size)}
+}
+
+func (b *LogBuffer) add(level, msg string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.lines) == 0 {
+		return
+	}
+	b.lines[b.next] = LogLine{Time: b.now(), Level: level, Message: msg}
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Error logs an error
+func (b *LogBuffer) Error(eid uint32, msg string) error {
+	b.add("error", msg)
+	return b.elog.Error(eid, msg)
+}
+
+// Warning logs a warning
+func (b *LogBuffer) Warning(eid uint32, msg string) error {
+	b.add("warning", msg)
+	return b.elog.Warning(eid, msg)
+}
+
+// Info logs an informational message
+func (b *LogBuffer) Info(eid uint32, msg string) error {
+	b.add("info", msg)
+	return b.elog.Info(eid, msg)
+}
+
+// Lines returns the last n lines kept, oldest first
+func (b *LogBuffer) Lines(n int) []LogLine {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ordered []LogLine
+	if b.full {
+		ordered = append(ordered, b.lines[b.next:]...)
+	}
+	ordered = append(ordered, b.lines[:b.next]...)
+	if n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+	return ordered
+}
@@ -0,0 +1,318 @@
+// Package reconcile computes the hosts entries wanted for the
+// WSL distros and the changes bringing the hosts files there,
+// without touching anything
+package reconcile
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/shayne/go-wsl2-host/internal/wsl2hosts"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// Target is a file changes are applied to
+type Target string
+
+const (
+	// WindowsHosts is the hosts file of Windows
+	WindowsHosts Target = "windows-hosts"
+	// DistroHosts is the /etc/hosts of a distro
+	DistroHosts Target = "distro-hosts"
+)
+
+// Action is the kind of a Change
+type Action string
+
+const (
+	// Add adds a hostname
+	Add Action = "add"
+	// Update changes the addresses or comment of a hostname
+	Update Action = "update"
+	// Remove removes a hostname
+	Remove Action = "remove"
+)
+
+// Entry is a hostname and its addresses
+type Entry struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip,omitempty"`
+	IPv6     string `json:"ipv6,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Change is one modification of a target
+type Change struct {
+	Target Target `json:"target"`
+	// Distro whose /etc/hosts changes, for DistroHosts
+	Distro string `json:"distro,omitempty"`
+	Action Action `json:"action"`
+	// Entry is the wanted entry, or the removed one
+	Entry Entry `json:"entry"`
+	// Old is the entry being updated
+	Old *Entry `json:"old,omitempty"`
+}
+
+// addresses returns the addresses of the entry separated by commas
+func (e Entry) addresses() string {
+	switch {
+	case e.IP != "" && e.IPv6 != "":
+		return e.IP + "," + e.IPv6
+	case e.IPv6 != "":
+		return e.IPv6
+	}
+	return e.IP
+}
+
+func (c Change) String() string {
+	target := string(c.Target)
+	if c.Distro != "" {
+		target += "[" + c.Distro + "]"
+	}
+	s := fmt.Sprintf("%s: %s %s %s", target, c.Action, c.Entry.Hostname, c.Entry.addresses())
+	if c.Old != nil && c.Old.addresses() != c.Entry.addresses() {
+		s = fmt.Sprintf("%s: %s %s %s -> %s", target, c.Action, c.Entry.Hostname, c.Old.addresses(), c.Entry.addresses())
+	}
+	return s
+}
+
+// Host is the Windows host
+type Host struct {
+	Name string
+	IP   string
+}
+
+// Input is what is known of the distros and the hosts files
+type Input struct {
+	// Distros whose Error is set are left alone, their entries
+	// being kept as they are
+	Distros []*wslapi.DistroInfo
+	// Names are the hostnames of the distros and of the
+	// Windows host, keyed by their name
+	Names map[string][]string
+	// Aliases of the default distro
+	Aliases []string
+	// Host is nil when the Windows host address is unknown,
+	// its entries are then left alone
+	Host *Host
+	// WindowsHost names the Windows host in the /etc/hosts of
+	// the distros, empty to leave it out
+	WindowsHost string
+	// Managed are the managed entries of the Windows hosts file
+	Managed map[string]Entry
+	// DistroHosts maps hostnames to the IP they resolve to in the
+	// /etc/hosts of the running distros, distros missing from it
+	// are left alone
+	DistroHosts map[string]map[string]string
+	// WindowsTarget and DistroTarget enable the changes of the
+	// Windows hosts file and of the distros /etc/hosts
+	WindowsTarget bool
+	DistroTarget  bool
+}
+
+// State is the wanted content of the hosts files
+type State struct {
+	// Windows are the managed entries of the Windows hosts file
+	Windows map[string]Entry
+	// Distros maps hostnames to the IP they should resolve to in
+	// the /etc/hosts of each running distro
+	Distros map[string]map[string]string
+}
+
+// Plan is the wanted state and the changes reaching it
+type Plan struct {
+	Input   *Input
+	Desired *State
+	Changes []Change
+}
+
+// Empty reports whether the plan changes nothing
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Compute returns the plan bringing the hosts files in line
+// with the distros
+func Compute(in *Input) *Plan {
+	desired := &State{
+		Windows: desiredWindows(in),
+		Distros: desiredDistros(in),
+	}
+	p := &Plan{Input: in, Desired: desired}
+	if in.WindowsTarget {
+		p.Changes = append(p.Changes, diffWindows(in.Managed, desired.Windows)...)
+	}
+	if in.DistroTarget {
+		p.Changes = append(p.Changes, diffDistros(in.DistroHosts, desired.Distros)...)
+	}
+	return p
+}
+
+func defaultDistro(distros []*wslapi.DistroInfo) *wslapi.DistroInfo {
+	for _, i := range distros {
+		if i.Default {
+			return i
+		}
+	}
+	return nil
+}
+
+// keep wants the managed entry of hostname as it is, the
+// addresses of its distro being unknown
+func keep(want, managed map[string]Entry, hostname string) {
+	if e, exists := managed[hostname]; exists {
+		want[hostname] = e
+	}
+}
+
+func desiredWindows(in *Input) map[string]Entry {
+	want := make(map[string]Entry)
+	stopped := make(map[string]bool)
+	for _, i := range in.Distros {
+		for _, hostname := range in.Names[i.Name] {
+			if !i.Running {
+				stopped[hostname] = true
+				continue
+			}
+			if i.Error != "" {
+				keep(want, in.Managed, hostname)
+				continue
+			}
+			want[hostname] = Entry{
+				Hostname: hostname,
+				IP:       i.IP,
+				IPv6:     i.PreferredIPv6(),
+				Comment:  wsl2hosts.PrimaryComment(i.Name),
+			}
+		}
+	}
+
+	if def := defaultDistro(in.Distros); def != nil && def.Running {
+		for _, alias := range in.Aliases {
+			if _, exists := want[alias]; exists || alias == "" {
+				continue
+			}
+			if def.Error != "" {
+				keep(want, in.Managed, alias)
+				continue
+			}
+			want[alias] = Entry{
+				Hostname: alias,
+				IP:       def.IP,
+				IPv6:     def.PreferredIPv6(),
+				Comment:  wsl2hosts.DistroComment(def.Name),
+			}
+		}
+	}
+
+	if in.Host != nil {
+		for _, hostname := range in.Names[in.Host.Name] {
+			if _, exists := want[hostname]; exists {
+				continue
+			}
+			want[hostname] = Entry{
+				Hostname: hostname,
+				IP:       in.Host.IP,
+				Comment:  wsl2hosts.HostComment(in.Host.Name),
+			}
+		}
+	}
+
+	// entries left from stopped distros, removed aliases or a
+	// previous configuration go away, others are kept as they are
+	for hostname, e := range in.Managed {
+		if _, exists := want[hostname]; exists || stopped[hostname] {
+			continue
+		}
+		if wsl2hosts.IsAlias(e.Comment) {
+			continue
+		}
+		if _, err := wsl2hosts.DistroName(e.Comment); err == nil {
+			continue
+		}
+		if wsl2hosts.IsHost(e.Comment) && in.Host != nil {
+			continue
+		}
+		want[hostname] = e
+	}
+	return want
+}
+
+func desiredDistros(in *Input) map[string]map[string]string {
+	want := make(map[string]map[string]string)
+	for _, d := range in.Distros {
+		if !d.Running || d.Error != "" {
+			continue
+		}
+		hosts := make(map[string]string)
+		if in.WindowsHost != "" && in.Host != nil {
+			hosts[in.WindowsHost] = in.Host.IP
+		}
+		for _, other := range in.Distros {
+			if !other.Running || other.Error != "" || other.Name == d.Name {
+				continue
+			}
+			for _, hostname := range in.Names[other.Name] {
+				hosts[hostname] = other.IP
+			}
+		}
+		want[d.Name] = hosts
+	}
+	return want
+}
+
+func diffWindows(current, want map[string]Entry) []Change {
+	var changes []Change
+	for hostname, e := range want {
+		old, exists := current[hostname]
+		switch {
+		case !exists:
+			changes = append(changes, Change{Target: WindowsHosts, Action: Add, Entry: e})
+		case old != e:
+			o := old
+			changes = append(changes, Change{Target: WindowsHosts, Action: Update, Entry: e, Old: &o})
+		}
+	}
+	for hostname, e := range current {
+		if _, exists := want[hostname]; !exists {
+			changes = append(changes, Change{Target: WindowsHosts, Action: Remove, Entry: e})
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+// diffDistros only adds and updates, the /etc/hosts lines of
+// the distros not being tagged as managed
+func diffDistros(current, want map[string]map[string]string) []Change {
+	var changes []Change
+	for distro, hosts := range want {
+		have, known := current[distro]
+		if !known {
+			continue
+		}
+		for hostname, ip := range hosts {
+			e := Entry{Hostname: hostname, IP: ip}
+			old, exists := have[hostname]
+			switch {
+			case !exists:
+				changes = append(changes, Change{Target: DistroHosts, Distro: distro, Action: Add, Entry: e})
+			case old != ip:
+				changes = append(changes, Change{Target: DistroHosts, Distro: distro, Action: Update, Entry: e,
+					Old: &Entry{Hostname: hostname, IP: old}})
+			}
+		}
+	}
+	sortChanges(changes)
+	return changes
+}
+
+func sortChanges(changes []Change) {
+	sort.Slice(changes, func(a, b int) bool {
+		ca, cb := changes[a], changes[b]
+		if ca.Distro != cb.Distro {
+			return ca.Distro < cb.Distro
+		}
+		return ca.Entry.Hostname < cb.Entry.Hostname
+	})
+}
@@ -0,0 +1,212 @@
+package reconcile
+
+import (
+	"testing"
+
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ubuntuComment = "distro: Ubuntu-18.04; managed by wsl2-host"
+	debianComment = "distro: Debian; managed by wsl2-host"
+	aliasComment  = "alias: Ubuntu-18.04; managed by wsl2-host"
+	hostComment   = "host: DESKTOP-1234; managed by wsl2-host"
+)
+
+func distros(debianRunning bool) []*wslapi.DistroInfo {
+	debian := &wslapi.DistroInfo{Name: "Debian", Version: 2, Running: debianRunning}
+	if debianRunning {
+		debian.IP = "172.18.192.7"
+	}
+	return []*wslapi.DistroInfo{
+		{Name: "Ubuntu-18.04", Version: 2, Running: true, Default: true, IP: "172.18.192.5",
+			IPv6: []string{"2001:db8::5", "fe80::5"}},
+		debian,
+	}
+}
+
+var names = map[string][]string{
+	"Ubuntu-18.04": {"ubuntu1804.wsl"},
+	"Debian":       {"debian.wsl"},
+	"DESKTOP-1234": {"desktop1234.wsl"},
+}
+
+func input(debianRunning bool, managed map[string]Entry, distroHosts map[string]map[string]string) *Input {
+	return &Input{
+		Distros:       distros(debianRunning),
+		Names:         names,
+		Aliases:       []string{"app.local"},
+		Host:          &Host{Name: "DESKTOP-1234", IP: "172.18.192.1"},
+		WindowsHost:   "windows.local",
+		Managed:       managed,
+		DistroHosts:   distroHosts,
+		WindowsTarget: true,
+		DistroTarget:  true,
+	}
+}
+
+// inSync are the managed entries matching input(false, ...)
+func inSync() map[string]Entry {
+	return map[string]Entry{
+		"ubuntu1804.wsl":  {Hostname: "ubuntu1804.wsl", IP: "172.18.192.5", IPv6: "2001:db8::5", Comment: ubuntuComment},
+		"app.local":       {Hostname: "app.local", IP: "172.18.192.5", IPv6: "2001:db8::5", Comment: aliasComment},
+		"desktop1234.wsl": {Hostname: "desktop1234.wsl", IP: "172.18.192.1", Comment: hostComment},
+	}
+}
+
+func with(entries map[string]Entry, e Entry) map[string]Entry {
+	entries[e.Hostname] = e
+	return entries
+}
+
+func without(entries map[string]Entry, hostname string) map[string]Entry {
+	delete(entries, hostname)
+	return entries
+}
+
+func TestCompute(t *testing.T) {
+	ubuntuHosts := map[string]map[string]string{"Ubuntu-18.04": {"windows.local": "172.18.192.1"}}
+
+	tests := []struct {
+		name    string
+		in      *Input
+		changes []Change
+	}{
+		{
+			name: "in sync",
+			in:   input(false, inSync(), ubuntuHosts),
+		},
+		{
+			name: "empty hosts files",
+			in:   input(false, map[string]Entry{}, map[string]map[string]string{"Ubuntu-18.04": {}}),
+			changes: []Change{
+				{Target: WindowsHosts, Action: Add, Entry: inSync()["app.local"]},
+				{Target: WindowsHosts, Action: Add, Entry: inSync()["desktop1234.wsl"]},
+				{Target: WindowsHosts, Action: Add, Entry: inSync()["ubuntu1804.wsl"]},
+				{Target: DistroHosts, Distro: "Ubuntu-18.04", Action: Add,
+					Entry: Entry{Hostname: "windows.local", IP: "172.18.192.1"}},
+			},
+		},
+		{
+			name: "distro IP changed",
+			in: input(false, with(inSync(), Entry{Hostname: "ubuntu1804.wsl", IP: "172.18.192.3", Comment: ubuntuComment}),
+				ubuntuHosts),
+			changes: []Change{
+				{Target: WindowsHosts, Action: Update, Entry: inSync()["ubuntu1804.wsl"],
+					Old: &Entry{Hostname: "ubuntu1804.wsl", IP: "172.18.192.3", Comment: ubuntuComment}},
+			},
+		},
+		{
+			name: "stopped distro and legacy entries removed",
+			in: input(false, with(with(inSync(),
+				Entry{Hostname: "debian.wsl", IP: "172.18.192.7", Comment: "managed by wsl2-host"}),
+				Entry{Hostname: "old.wsl", IP: "172.18.192.7", Comment: debianComment}),
+				ubuntuHosts),
+			changes: []Change{
+				{Target: WindowsHosts, Action: Remove,
+					Entry: Entry{Hostname: "debian.wsl", IP: "172.18.192.7", Comment: "managed by wsl2-host"}},
+				{Target: WindowsHosts, Action: Remove,
+					Entry: Entry{Hostname: "old.wsl", IP: "172.18.192.7", Comment: debianComment}},
+			},
+		},
+		{
+			name: "removed alias",
+			in: input(false, with(inSync(), Entry{Hostname: "api.local", IP: "172.18.192.5", Comment: aliasComment}),
+				ubuntuHosts),
+			changes: []Change{
+				{Target: WindowsHosts, Action: Remove,
+					Entry: Entry{Hostname: "api.local", IP: "172.18.192.5", Comment: aliasComment}},
+			},
+		},
+		{
+			name: "unknown entries kept",
+			in: input(false, with(inSync(), Entry{Hostname: "mine.local", IP: "10.0.0.1", Comment: "mine"}),
+				ubuntuHosts),
+		},
+		{
+			name: "second distro started",
+			in: input(true, inSync(), map[string]map[string]string{
+				"Ubuntu-18.04": {"windows.local": "172.18.192.1", "debian.wsl": "172.18.192.2"},
+				"Debian":       {"windows.local": "172.18.192.1"},
+			}),
+			changes: []Change{
+				{Target: WindowsHosts, Action: Add,
+					Entry: Entry{Hostname: "debian.wsl", IP: "172.18.192.7", Comment: debianComment}},
+				{Target: DistroHosts, Distro: "Debian", Action: Add,
+					Entry: Entry{Hostname: "ubuntu1804.wsl", IP: "172.18.192.5"}},
+				{Target: DistroHosts, Distro: "Ubuntu-18.04", Action: Update,
+					Entry: Entry{Hostname: "debian.wsl", IP: "172.18.192.7"},
+					Old:   &Entry{Hostname: "debian.wsl", IP: "172.18.192.2"}},
+			},
+		},
+		{
+			name: "unreadable distro hosts left alone",
+			in:   input(false, inSync(), map[string]map[string]string{}),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := Compute(test.in)
+			assert.Equal(t, test.changes, p.Changes)
+			assert.Equal(t, len(test.changes) == 0, p.Empty())
+		})
+	}
+}
+
+func TestComputeUnknownHost(t *testing.T) {
+	in := input(false, inSync(), map[string]map[string]string{"Ubuntu-18.04": {}})
+	in.Host = nil
+	p := Compute(in)
+	// the host entry is kept, the distros not told about it
+	assert.Empty(t, p.Changes)
+	assert.Equal(t, inSync(), p.Desired.Windows)
+	assert.Equal(t, map[string]map[string]string{"Ubuntu-18.04": {}}, p.Desired.Distros)
+}
+
+func TestComputeTargets(t *testing.T) {
+	in := input(true, map[string]Entry{}, map[string]map[string]string{"Ubuntu-18.04": {}, "Debian": {}})
+	in.WindowsTarget = false
+	in.DistroTarget = false
+	p := Compute(in)
+	assert.True(t, p.Empty())
+	assert.Len(t, p.Desired.Windows, 4)
+	assert.Equal(t, map[string]string{
+		"windows.local": "172.18.192.1",
+		"debian.wsl":    "172.18.192.7",
+	}, p.Desired.Distros["Ubuntu-18.04"])
+}
+
+func TestComputeDistroError(t *testing.T) {
+	in := input(true, inSync(), map[string]map[string]string{
+		"Ubuntu-18.04": {"windows.local": "172.18.192.1"},
+		"Debian":       {"windows.local": "172.18.192.1"},
+	})
+	// the default distro could not be discovered
+	in.Distros[0].IP = ""
+	in.Distros[0].IPv6 = nil
+	in.Distros[0].Error = "failed to get IP"
+	p := Compute(in)
+	assert.Equal(t, []Change{
+		{Target: WindowsHosts, Action: Add,
+			Entry: Entry{Hostname: "debian.wsl", IP: "172.18.192.7", Comment: debianComment}},
+	}, p.Changes)
+	assert.Equal(t, inSync()["ubuntu1804.wsl"], p.Desired.Windows["ubuntu1804.wsl"])
+	assert.Equal(t, inSync()["app.local"], p.Desired.Windows["app.local"])
+	assert.NotContains(t, p.Desired.Distros, "Ubuntu-18.04")
+	assert.Equal(t, map[string]string{"windows.local": "172.18.192.1"}, p.Desired.Distros["Debian"])
+}
+
+func TestChangeString(t *testing.T) {
+	assert.Equal(t, "windows-hosts: add app.local 172.18.192.5,2001:db8::5",
+		Change{Target: WindowsHosts, Action: Add,
+			Entry: Entry{Hostname: "app.local", IP: "172.18.192.5", IPv6: "2001:db8::5"}}.String())
+	assert.Equal(t, "distro-hosts[Debian]: update windows.local 172.18.192.9 -> 172.18.192.1",
+		Change{Target: DistroHosts, Distro: "Debian", Action: Update,
+			Entry: Entry{Hostname: "windows.local", IP: "172.18.192.1"},
+			Old:   &Entry{Hostname: "windows.local", IP: "172.18.192.9"}}.String())
+	assert.Equal(t, "windows-hosts: update debian.wsl 172.18.192.7",
+		Change{Target: WindowsHosts, Action: Update,
+			Entry: Entry{Hostname: "debian.wsl", IP: "172.18.192.7", Comment: "distro: Debian"},
+			Old:   &Entry{Hostname: "debian.wsl", IP: "172.18.192.7", Comment: "managed by wsl2-host"}}.String())
+}
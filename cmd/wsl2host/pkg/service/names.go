@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shayne/go-wsl2-host/internal/naming"
+	"github.com/shayne/go-wsl2-host/pkg/hostsapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// hostnames are the names handed out by a run
+type hostnames struct {
+	// names of the distros and of the Windows host, keyed by name
+	names map[string][]string
+	// aliases of the default distro
+	aliases    []string
+	collisions []*naming.CollisionError
+}
+
+// unmanagedHostnames returns the hostnames of the hosts file
+// lines the service does not manage
+func (s *Service) unmanagedHostnames() map[string]string {
+	reserved := make(map[string]string)
+	hapi, err := hostsapi.CreateAPI(s.cfg.HostsPath, s.cfg.Filter)
+	if err != nil {
+		return reserved
+	}
+	defer hapi.Close()
+	for _, e := range hapi.Unmanaged() {
+		if _, exists := reserved[e.Hostname]; !exists {
+			reserved[e.Hostname] = fmt.Sprintf("hosts file line %d", e.LineNumber())
+		}
+	}
+	return reserved
+}
+
+// resolveNames computes the hostnames of the distros, of the
+// Windows host and the aliases of the default distro, settling
+// collisions between them and with the unmanaged hosts file
+// lines with the configured policy
+// Distros whose templates fail are logged and left unnamed
+func (s *Service) resolveNames(distros []*wslapi.DistroInfo) (*hostnames, error) {
+	namer, err := s.cfg.Namer()
+	if err != nil {
+		return nil, err
+	}
+	policy, err := naming.ParsePolicy(s.cfg.Names.Collisions)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims []naming.Claim
+	var keys []string
+	claim := func(key, owner, suffix string, names []string) {
+		keys = append(keys, key)
+		claims = append(claims, naming.Claim{Owner: owner, Suffix: suffix, Names: names})
+	}
+	var defdistro *wslapi.DistroInfo
+	for _, i := range distros {
+		names, err := namer.Names(naming.Distro{
+			Name:           i.Name,
+			Version:        i.Version,
+			Default:        i.Default,
+			ID:             i.ID,
+			Hostname:       i.Hostname,
+			User:           i.DefaultUser,
+			NetworkingMode: i.NetworkingMode,
+			Kernel:         i.Kernel,
+		})
+		if err != nil {
+			s.elog.Error(1, fmt.Sprintf("naming: %v", err))
+		}
+		claim(i.Name, "distro "+i.Name, i.Name, names)
+		if i.Default {
+			defdistro = i
+		}
+	}
+	if hostname, err := s.hostname(); err == nil {
+		names, err := namer.Names(naming.Distro{Name: hostname})
+		if err != nil {
+			s.elog.Error(1, fmt.Sprintf("naming: %v", err))
+		}
+		claim(hostname, "Windows host "+hostname, hostname, names)
+	}
+	aliasidx := -1
+	if defdistro != nil && defdistro.Running {
+		aliasidx = len(claims)
+		claim("", "alias of "+defdistro.Name, defdistro.Name, s.hostAliases())
+	}
+
+	resolved, collisions := naming.Resolve(claims, s.unmanagedHostnames(), policy)
+	hn := &hostnames{
+		names:      make(map[string][]string),
+		collisions: collisions,
+	}
+	for idx, names := range resolved {
+		if idx == aliasidx {
+			hn.aliases = names
+			continue
+		}
+		hn.names[keys[idx]] = names
+	}
+	return hn, nil
+}
+
+// reportCollisions logs the collisions when they differ from
+// those of the previous run, as errors under the error policy
+// and warnings otherwise
+func (s *Service) reportCollisions(collisions []*naming.CollisionError) {
+	var msgs []string
+	for _, c := range collisions {
+		msgs = append(msgs, c.Error())
+	}
+	report := strings.Join(msgs, "\n")
+	if report == s.collisions {
+		return
+	}
+	s.collisions = report
+	for _, msg := range msgs {
+		if s.cfg.Names.Collisions == string(naming.Error) {
+			s.elog.Error(1, msg)
+		} else {
+			s.elog.Warning(1, msg)
+		}
+	}
+}
+
+// Collisions discovers the distros and returns the hostnames
+// claimed more than once, settled by the configured policy
+func (s *Service) Collisions() ([]*naming.CollisionError, error) {
+	infos, err := s.wsl.GetAllInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get infos: %w", err)
+	}
+	hn, err := s.resolveNames(infos)
+	if err != nil {
+		return nil, err
+	}
+	return hn.collisions, nil
+}
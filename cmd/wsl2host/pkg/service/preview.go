@@ -0,0 +1,78 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/internal/diff"
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+)
+
+// FileDiff is the unified diff of a file changed by a plan
+type FileDiff struct {
+	Target reconcile.Target `json:"target"`
+	Distro string           `json:"distro,omitempty"`
+	Path   string           `json:"path"`
+	Diff   string           `json:"diff"`
+}
+
+// distroHostsPath returns the Windows path of the /etc/hosts
+// of distro
+func distroHostsPath(distro string) string {
+	return fmt.Sprintf(`\\wsl$\%s\etc\hosts`, distro)
+}
+
+// Preview returns the diffs of the files Apply would change
+// with plan, without touching them
+func (s *Service) Preview(plan *reconcile.Plan) ([]FileDiff, error) {
+	var windows []reconcile.Change
+	var distros []string
+	bydistro := make(map[string][]reconcile.Change)
+	for _, c := range plan.Changes {
+		switch c.Target {
+		case reconcile.WindowsHosts:
+			windows = append(windows, c)
+		case reconcile.DistroHosts:
+			if _, seen := bydistro[c.Distro]; !seen {
+				distros = append(distros, c.Distro)
+			}
+			bydistro[c.Distro] = append(bydistro[c.Distro], c)
+		}
+	}
+
+	var diffs []FileDiff
+	if len(windows) > 0 {
+		hapi, err := s.stageWindows(windows)
+		if err != nil {
+			return nil, err
+		}
+		defer hapi.Close()
+		path := hapi.Path()
+		d := diff.Unified(path, path+" (planned)", string(hapi.Content()), string(hapi.Render()))
+		if d != "" {
+			diffs = append(diffs, FileDiff{Target: reconcile.WindowsHosts, Path: path, Diff: d})
+		}
+	}
+
+	for _, distro := range distros {
+		before, err := s.wsl.ReadHosts(distro)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read distro[%s] hosts: %w", distro, err)
+		}
+		after := before
+		for _, c := range bydistro[distro] {
+			switch c.Action {
+			case reconcile.Add:
+				after = wslcli.PreviewAddHostIP(after, c.Entry.Hostname, c.Entry.IP)
+			case reconcile.Update:
+				after = wslcli.PreviewUpdateHostIP(after, c.Entry.Hostname, c.Old.IP, c.Entry.IP)
+			}
+		}
+		path := distroHostsPath(distro)
+		d := diff.Unified(path, path+" (planned)", before, after)
+		if d != "" {
+			diffs = append(diffs, FileDiff{Target: reconcile.DistroHosts, Distro: distro, Path: path, Diff: d})
+		}
+	}
+	return diffs, nil
+}
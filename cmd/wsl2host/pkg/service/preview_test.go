@@ -0,0 +1,77 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	content := "127.0.0.1 localhost\r\n" +
+		"172.18.192.7 debian.wsl    # managed by wsl2-host\r\n"
+	err = ioutil.WriteFile(hostspath, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(hostspath)
+	cfg.Aliases.File = ""
+	r := fakeRunner()
+	s := New(&testLog{}, wslapi.New(wslcli.New(r)), cfg)
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() { t.Fatal("preview restarted iphlpsvc") }
+
+	plan, err := s.Plan()
+	assert.Nil(t, err)
+	assert.Len(t, plan.Changes, 4)
+	diffs, err := s.Preview(plan)
+	assert.Nil(t, err)
+	assert.Equal(t, []FileDiff{
+		{
+			Target: reconcile.WindowsHosts,
+			Path:   hostspath,
+			Diff: "--- " + hostspath + "\n" +
+				"+++ " + hostspath + " (planned)\n" +
+				"@@ -1,2 +1,6 @@\n" +
+				" 127.0.0.1 localhost\n" +
+				"-172.18.192.7 debian.wsl    # managed by wsl2-host\n" +
+				"+# BEGIN wsl2-host\n" +
+				"+172.18.192.1 desktop1234.wsl    # host: DESKTOP-1234; managed by wsl2-host\n" +
+				"+172.18.192.5 ubuntu1804.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\n" +
+				"+2001:db8:0:1:215:54ff:fe7b:9a1c ubuntu1804.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\n" +
+				"+# END wsl2-host\n",
+		},
+		{
+			Target: reconcile.DistroHosts,
+			Distro: "Ubuntu-18.04",
+			Path:   `\\wsl$\Ubuntu-18.04\etc\hosts`,
+			Diff: `--- \\wsl$\Ubuntu-18.04\etc\hosts` + "\n" +
+				`+++ \\wsl$\Ubuntu-18.04\etc\hosts (planned)` + "\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" 127.0.0.1 localhost\n" +
+				"-172.18.192.9 windows.local\n" +
+				"+172.18.192.1 windows.local\n",
+		},
+	}, diffs)
+
+	// nothing was written
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(b))
+	for _, c := range r.Calls {
+		assert.NotContains(t, c, "sed")
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// ReverseMap maps IP addresses back to the hostnames
+// pointing at them
+type ReverseMap map[string][]string
+
+func normalizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	return parsed.String()
+}
+
+// Lookup returns the hostnames of ip, the distro's own
+// hostname before its aliases
+func (r ReverseMap) Lookup(ip string) []string {
+	return r[normalizeIP(ip)]
+}
+
+// add maps ip to hostname, except for loopback and link-local
+// addresses which do not identify a distro, WSL 1 distros sharing
+// the loopback address of Windows
+func (r ReverseMap) add(ip, hostname string) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() || parsed.IsUnspecified() {
+		return
+	}
+	ip = parsed.String()
+	for _, h := range r[ip] {
+		if h == hostname {
+			return
+		}
+	}
+	r[ip] = append(r[ip], hostname)
+}
+
+// BuildReverseMap computes the reverse mappings of the running
+// distros, names being their hostnames keyed by distro name and
+// aliases those of the default distro
+func BuildReverseMap(distros []*wslapi.DistroInfo, names map[string][]string, aliases []string) ReverseMap {
+	r := make(ReverseMap)
+	running := make([]*wslapi.DistroInfo, 0, len(distros))
+	for _, i := range distros {
+		if i.Running {
+			running = append(running, i)
+		}
+	}
+	sort.Slice(running, func(a, b int) bool {
+		return running[a].Name < running[b].Name
+	})
+	for _, i := range running {
+		for _, hostname := range names[i.Name] {
+			for _, ip := range append(append([]string{}, i.IPv4...), i.IPv6...) {
+				r.add(ip, hostname)
+			}
+		}
+	}
+
+	sorted := append([]string{}, aliases...)
+	sort.Strings(sorted)
+	for _, i := range running {
+		if !i.Default {
+			continue
+		}
+		for _, alias := range sorted {
+			if alias == "" {
+				continue
+			}
+			for _, ip := range append(append([]string{}, i.IPv4...), i.IPv6...) {
+				r.add(ip, alias)
+			}
+		}
+	}
+	return r
+}
+
+// Reverse returns the reverse mappings computed by the last Run
+func (s *Service) Reverse() ReverseMap {
+	return s.reverse
+}
+
+// ReverseLookup discovers the distros and returns the hostnames
+// pointing at ip
+func (s *Service) ReverseLookup(ip string) ([]string, error) {
+	if net.ParseIP(ip) == nil {
+		return nil, fmt.Errorf("invalid IP address: %s", ip)
+	}
+	infos, err := s.wsl.GetAllInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get infos: %w", err)
+	}
+	hn, err := s.resolveNames(infos)
+	if err != nil {
+		return nil, err
+	}
+	return BuildReverseMap(infos, hn.names, hn.aliases).Lookup(ip), nil
+}
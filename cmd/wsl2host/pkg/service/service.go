@@ -1,205 +1,439 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
-	"strings"
+	"sort"
+	"time"
 
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
 	"github.com/shayne/go-wsl2-host/internal/wsl2hosts"
-	"golang.org/x/sys/windows/svc/debug"
 
+	"github.com/shayne/go-wsl2-host/pkg/dnsserver"
 	"github.com/shayne/go-wsl2-host/pkg/hostsapi"
 
 	"github.com/shayne/go-wsl2-host/pkg/wslapi"
 )
 
-const tld = ".wsl"
-const windowshost = "windows.local"
+// groupByDistro orders hosts entries by the distro they point to,
+// the Windows host entry first
+func groupByDistro(e *hostsapi.HostEntry) string {
+	name, err := wsl2hosts.DistroName(e.Comment)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// Logger is the subset of the Windows service debug.Log
+// used to report progress and failures
+type Logger interface {
+	Error(eid uint32, msg string) error
+	Warning(eid uint32, msg string) error
+	Info(eid uint32, msg string) error
+}
 
-var hostnamereg, _ = regexp.Compile("[^A-Za-z0-9]+")
+// Service keeps the hosts file and the /etc/hosts of each
+// running distro in sync with the WSL distros
+type Service struct {
+	elog    Logger
+	wsl     *wslapi.API
+	cfg     *config.Config
+	dns     *dnsserver.Server
+	reverse ReverseMap
+	// collisions reported by the last Run, logged when they change
+	collisions string
+	// statepath is where Run records its outcome, unset to not record it
+	statepath string
+	// last is the outcome of the last Run
+	last   *RunState
+	paused map[reconcile.Target]bool
+	now    func() time.Time
 
-func distroNameToHostname(distroname string) string {
-	// Ubuntu-18.04
-	// => ubuntu1804.wsl
-	hostname := strings.ToLower(distroname)
-	hostname = hostnamereg.ReplaceAllString(hostname, "")
-	return hostname + tld
+	// overridable for tests, these touch the Windows host
+	hostIP          func() (string, error)
+	hostname        func() (string, error)
+	restartIPHelper func()
 }
 
-// Run main entry point to service logic
-func Run(elog debug.Log) error {
-	// Then get all wsl info. and run them with config.
-	infos, err := wslapi.GetAllInfo()
-	if err != nil {
-		elog.Error(1, fmt.Sprintf("failed to get infos: %v", err))
-		return fmt.Errorf("failed to get infos: %w", err)
+// New creates a Service querying distros through wsl and
+// updating the targets enabled in cfg
+func New(elog Logger, wsl *wslapi.API, cfg *config.Config) *Service {
+	wsl.SetExcludes(cfg.ExcludeDistros)
+	wsl.SetSource(wslapi.Source(cfg.DistroSource))
+	if selection, err := cfg.Selection(); err == nil {
+		wsl.SetSelection(selection)
 	}
-
-	err = updateHostIP(elog, infos)
-	if err != nil {
-		elog.Error(1, fmt.Sprintf("failed to update host IP info: %s", err))
+	return &Service{
+		elog:            elog,
+		wsl:             wsl,
+		cfg:             cfg,
+		hostIP:          hostsapi.GetHostIP,
+		hostname:        os.Hostname,
+		restartIPHelper: restartIPHelper,
+		now:             time.Now,
 	}
+}
 
-	for _, i := range infos {
-		if i.Running {
-			err = updateDistroIP(elog, infos, i.Name)
-			if err != nil {
-				elog.Error(1, fmt.Sprintf("failed to update distro[%s] IP info: %s", i.Name, err))
+// SetDNS makes Run publish the managed hostnames to the
+// given DNS responder
+func (s *Service) SetDNS(dns *dnsserver.Server) {
+	s.dns = dns
+}
+
+// publishRecords hands the managed entries to the DNS responder
+func (s *Service) publishRecords(entries map[string]reconcile.Entry) {
+	if s.dns == nil {
+		return
+	}
+	records := make(map[string][]string)
+	for hostname, e := range entries {
+		for _, ip := range []string{e.IP, e.IPv6} {
+			if ip != "" {
+				records[hostname] = append(records[hostname], ip)
 			}
 		}
 	}
+	s.dns.SetRecords(records)
+	if s.reverse != nil {
+		s.dns.SetReverse(s.reverse)
+	}
+}
 
-	if err != nil {
-		return err
+// restartIPHelper restarts the IP Helper service (iphlpsvc) for port forwarding
+func restartIPHelper() {
+	exec.Command("C:\\Windows\\System32\\cmd.exe", "/C net stop  iphlpsvc").Run()
+	exec.Command("C:\\Windows\\System32\\cmd.exe", "/C net start iphlpsvc").Run()
+}
+
+// Config returns the configuration of the service
+func (s *Service) Config() *config.Config {
+	return s.cfg
+}
+
+// SetConfig replaces the configuration, taking effect on the
+// next Run
+func (s *Service) SetConfig(cfg *config.Config) {
+	s.wsl.SetExcludes(cfg.ExcludeDistros)
+	s.wsl.SetSource(wslapi.Source(cfg.DistroSource))
+	if selection, err := cfg.Selection(); err == nil {
+		s.wsl.SetSelection(selection)
 	}
+	s.cfg = cfg
+}
+
+// SetPaused stops or resumes the updates of a target, paused
+// targets being left alone by Run until resumed
+func (s *Service) SetPaused(target reconcile.Target, paused bool) error {
+	switch target {
+	case reconcile.WindowsHosts, reconcile.DistroHosts:
+	default:
+		return fmt.Errorf("unknown target %q", target)
+	}
+	if s.paused == nil {
+		s.paused = make(map[reconcile.Target]bool)
+	}
+	s.paused[target] = paused
 	return nil
 }
 
-func updateHostIP(elog debug.Log, distros []*wslapi.DistroInfo) error {
-	// update the ip to the wsl
-	hapi, err := hostsapi.CreateAPI("wsl2-host") // filtere only managed host entries
-	if err != nil {
-		elog.Error(1, fmt.Sprintf("failed to create hosts api: %v", err))
-		return fmt.Errorf("failed to create hosts api: %w", err)
+// Paused returns the paused targets
+func (s *Service) Paused() []reconcile.Target {
+	var targets []reconcile.Target
+	for target, paused := range s.paused {
+		if paused {
+			targets = append(targets, target)
+		}
 	}
+	sort.Slice(targets, func(a, b int) bool { return targets[a] < targets[b] })
+	return targets
+}
 
-	updated := false
-	hostentries := hapi.Entries()
+// hostAliases returns the aliases of the default distro, read
+// from the configured alias file and the static aliases
+func (s *Service) hostAliases() []string {
+	var aliases []string
+	if s.cfg.Aliases.File != "" {
+		aliases, _ = s.wsl.GetHostAliasesFrom(s.cfg.Aliases.File)
+	}
+	return append(aliases, s.cfg.Aliases.Static...)
+}
 
-	// update the wsl ip to host
-	for _, i := range distros {
-		hostname := distroNameToHostname(i.Name)
-		// remove stopped distros
-		if !i.Running {
-			err := hapi.RemoveEntry(hostname)
-			if err == nil {
-				updated = true
-			}
-			continue
-		}
+// Run main entry point to service logic
+func Run(elog Logger, cfg *config.Config) error {
+	s := New(elog, wslapi.Default, cfg)
+	if path, err := config.StatePath(); err == nil {
+		s.SetStatePath(path)
+	}
+	return s.Run()
+}
 
-		// update IPs of running distros
-		if he, exists := hostentries[hostname]; exists {
-			if he.IP != i.IP {
-				updated = true
-				he.IP = i.IP
-			}
-		} else {
-			// add running distros not present
-			err := hapi.AddEntry(&hostsapi.HostEntry{
-				Hostname: hostname,
-				IP:       i.IP,
-				Comment:  wsl2hosts.DefaultComment(),
-			})
-			if err == nil {
-				updated = true
-			}
-		}
+// runErrors are the failures of a run by target
+type runErrors struct {
+	windows error
+	distros map[string]error
+}
+
+func newRunErrors() *runErrors {
+	return &runErrors{distros: make(map[string]error)}
+}
+
+func (e *runErrors) setDistro(distro string, err error) {
+	if _, exists := e.distros[distro]; !exists {
+		e.distros[distro] = err
 	}
+}
+
+// first returns the Windows hosts file error, else the error
+// of the first distro by name
+func (e *runErrors) first() error {
+	if e.windows != nil {
+		return e.windows
+	}
+	var names []string
+	for name := range e.distros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		return e.distros[names[0]]
+	}
+	return nil
+}
 
-	// process aliases
-	defdistro, _ := wslapi.GetDefaultDistro()
+// planned is a plan along with what Run needs besides it
+type planned struct {
+	*reconcile.Plan
+	names *hostnames
+	// errs are the targets that could not be read, left
+	// out of the plan
+	errs *runErrors
+}
+
+// plan discovers the distros and reads the targets, failing
+// only when the distros cannot be discovered or named
+func (s *Service) plan() (*planned, error) {
+	infos, err := s.wsl.GetAllInfo()
 	if err != nil {
-		elog.Error(1, fmt.Sprintf("GetDefaultDistro failed: %v", err))
-		return fmt.Errorf("GetDefaultDistro failed: %w", err)
-	}
-	var aliasmap = make(map[string]interface{})
-	defdistroip, _ := wslapi.GetIP(defdistro.Name)
-	if defdistro.Running {
-		aliases, err := wslapi.GetHostAliases()
-		if err == nil {
-			for _, a := range aliases {
-				aliasmap[a] = nil
-			}
+		return nil, fmt.Errorf("failed to get infos: %w", err)
+	}
+	hn, err := s.resolveNames(infos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to name distros: %w", err)
+	}
+
+	p := &planned{names: hn, errs: newRunErrors()}
+	in := &reconcile.Input{
+		Distros:       infos,
+		Names:         hn.names,
+		Aliases:       hn.aliases,
+		WindowsHost:   s.cfg.WindowsHost,
+		Managed:       make(map[string]reconcile.Entry),
+		DistroHosts:   make(map[string]map[string]string),
+		WindowsTarget: s.cfg.Targets.WindowsHosts && !s.paused[reconcile.WindowsHosts],
+		DistroTarget:  s.cfg.Targets.DistroHosts && !s.paused[reconcile.DistroHosts],
+	}
+	if ip, err := s.hostIP(); err == nil {
+		if name, err := s.hostname(); err == nil {
+			in.Host = &reconcile.Host{Name: name, IP: ip}
 		}
 	}
-	// update entries after distro processing
-	hostentries = hapi.Entries()
-	for _, he := range hostentries {
-		if !wsl2hosts.IsAlias(he.Comment) {
-			continue
+
+	hapi, err := hostsapi.CreateAPI(s.cfg.HostsPath, s.cfg.Filter)
+	if err == nil {
+		for hostname, he := range hapi.Entries() {
+			in.Managed[hostname] = reconcile.Entry{Hostname: hostname, IP: he.IP, IPv6: he.IPv6, Comment: he.Comment}
+		}
+		hapi.Close()
+	} else if in.WindowsTarget {
+		in.WindowsTarget = false
+		p.errs.windows = fmt.Errorf("failed to create hosts api: %w", err)
+	}
+
+	for _, i := range infos {
+		if i.Error != "" {
+			p.errs.setDistro(i.Name, errors.New(i.Error))
 		}
-		// update IP for aliases when running and if it exists in aliasmap
-		if _, ok := aliasmap[he.Hostname]; ok && defdistro.Running {
-			if he.IP != defdistroip {
-				updated = true
-				he.IP = defdistroip
+	}
+	if in.DistroTarget {
+		for _, i := range infos {
+			if !i.Running || i.Error != "" {
+				continue
 			}
-		} else { // remove entry when not running or not in aliasmap
-			err := hapi.RemoveEntry(he.Hostname)
-			if err == nil {
-				updated = true
+			hosts, err := s.wsl.GetHosts(i.Name)
+			if err != nil {
+				p.errs.setDistro(i.Name, fmt.Errorf("failed to read distro[%s] hosts: %w", i.Name, err))
+				continue
 			}
+			in.DistroHosts[i.Name] = hosts
 		}
 	}
 
-	for hostname := range aliasmap {
-		// add new aliases
-		if _, ok := hostentries[hostname]; !ok && defdistro.Running {
-			err := hapi.AddEntry(&hostsapi.HostEntry{
-				IP:       defdistroip,
-				Hostname: hostname,
-				Comment:  wsl2hosts.DistroComment(defdistro.Name),
-			})
-			if err == nil {
-				updated = true
-			}
-		}
+	p.Plan = reconcile.Compute(in)
+	return p, nil
+}
+
+// Plan discovers the distros and returns the changes Run would
+// make, targets that cannot be read being left out
+func (s *Service) Plan() (*reconcile.Plan, error) {
+	p, err := s.plan()
+	if err != nil {
+		return nil, err
 	}
+	return p.Plan, nil
+}
 
-	hostIP, err := hostsapi.GetHostIP()
+// Run updates the hosts files once
+func (s *Service) Run() error {
+	elog := s.elog
+	p, err := s.plan()
+	if err != nil {
+		elog.Error(1, fmt.Sprintf("%v", err))
+		s.saveState(nil, nil, err)
+		return err
+	}
+	s.reportCollisions(p.names.collisions)
+	if p.errs.windows != nil {
+		elog.Error(1, fmt.Sprintf("%v", p.errs.windows))
+	}
+	for _, err := range p.errs.distros {
+		elog.Error(1, fmt.Sprintf("%v", err))
+	}
 
-	if err == nil {
-		hostname, err := os.Hostname()
-		hostAlias := distroNameToHostname(hostname)
-		err = hapi.AddEntry(&hostsapi.HostEntry{
-			IP:       hostIP,
-			Hostname: hostAlias,
-			Comment:  wsl2hosts.DistroComment(hostname),
-		})
+	results := s.apply(p.Plan, p.errs)
+	s.saveState(results, p.errs, nil)
+	return p.errs.first()
+}
 
-		if err == nil {
-			updated = true
-		}
+// Apply makes the changes of plan and publishes its wanted
+// state to the DNS responder
+func (s *Service) Apply(plan *reconcile.Plan) error {
+	errs := newRunErrors()
+	s.apply(plan, errs)
+	return errs.first()
+}
+
+// Publish discovers the distros and hands the wanted state to
+// the DNS responder only, leaving the hosts files alone
+func (s *Service) Publish() error {
+	p, err := s.plan()
+	if err != nil {
+		return err
 	}
+	s.publish(p.Plan)
+	return nil
+}
 
-	if updated {
-		err = hapi.Write()
-		if err != nil {
-			elog.Error(1, fmt.Sprintf("failed to write hosts file: %v", err))
-			return fmt.Errorf("failed to write hosts file: %w", err)
+// publish computes the reverse mappings of plan and hands its
+// wanted state to the DNS responder
+func (s *Service) publish(plan *reconcile.Plan) {
+	in := plan.Input
+	s.reverse = BuildReverseMap(in.Distros, in.Names, in.Aliases)
+	if in.Host != nil {
+		for _, hostname := range in.Names[in.Host.Name] {
+			s.reverse.add(in.Host.IP, hostname)
 		}
+	}
+	s.publishRecords(plan.Desired.Windows)
+}
+
+// apply makes the changes of plan, recording failures in errs,
+// and returns the outcome of every change
+func (s *Service) apply(plan *reconcile.Plan, errs *runErrors) []ChangeResult {
+	s.publish(plan)
 
-		// restart the IP Helper service (iphlpsvc) for port forwarding
-		exec.Command("C:\\Windows\\System32\\cmd.exe", "/C net stop  iphlpsvc").Run()
-		exec.Command("C:\\Windows\\System32\\cmd.exe", "/C net start iphlpsvc").Run()
+	var windows, distros []reconcile.Change
+	for _, c := range plan.Changes {
+		switch c.Target {
+		case reconcile.WindowsHosts:
+			windows = append(windows, c)
+		case reconcile.DistroHosts:
+			distros = append(distros, c)
+		}
 	}
 
-	return nil
+	var results []ChangeResult
+	if len(windows) > 0 {
+		err := s.applyWindows(windows)
+		if err != nil {
+			s.elog.Error(1, fmt.Sprintf("failed to update host IP info: %s", err))
+			errs.windows = err
+		}
+		for _, c := range windows {
+			results = append(results, newChangeResult(c, err))
+		}
+	}
+	for _, c := range distros {
+		err := s.applyDistro(c)
+		if err != nil {
+			s.elog.Error(1, fmt.Sprintf("failed to update distro[%s] IP info: %s", c.Distro, err))
+			errs.setDistro(c.Distro, err)
+		}
+		results = append(results, newChangeResult(c, err))
+	}
+	return results
 }
 
-/// Write all other distro and host into the hosts file for each distro.
-func updateDistroIP(elog debug.Log, distros []*wslapi.DistroInfo, distro string) error {
-	host_ip, err := hostsapi.GetHostIP()
+// applyWindows makes the changes to the Windows hosts file
+func (s *Service) applyWindows(changes []reconcile.Change) error {
+	hapi, err := s.stageWindows(changes)
 	if err != nil {
 		return err
 	}
-	err = wslapi.AddOrUpdateHostIP(distro, windowshost, host_ip)
+	defer hapi.Close()
+
+	err = hapi.Write()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to write hosts file: %w", err)
+	}
+	s.restartIPHelper()
+	return nil
+}
+
+// stageWindows loads the Windows hosts file and makes the
+// changes in memory
+func (s *Service) stageWindows(changes []reconcile.Change) (*hostsapi.HostsAPI, error) {
+	hapi, err := hostsapi.CreateAPI(s.cfg.HostsPath, s.cfg.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hosts api: %w", err)
 	}
+	hapi.SetGroupFunc(groupByDistro)
+	hapi.SetPreserveOrder(s.cfg.PreserveOrder)
+	hapi.SetMaxBackups(s.cfg.Backups)
 
-	for _, dist := range distros {
-		if !dist.Running || dist.Name == distro {
+	entries := hapi.Entries()
+	for _, c := range changes {
+		e := c.Entry
+		if c.Action == reconcile.Remove {
+			hapi.RemoveEntry(e.Hostname)
 			continue
 		}
-		hostAlias := distroNameToHostname(dist.Name)
-		err = wslapi.AddOrUpdateHostIP(distro, hostAlias, dist.IP)
-		if err != nil {
-			return err
+		if he, exists := entries[e.Hostname]; exists {
+			he.IP = e.IP
+			he.IPv6 = e.IPv6
+			he.Comment = e.Comment
+			continue
 		}
+		hapi.AddEntry(&hostsapi.HostEntry{
+			Hostname: e.Hostname,
+			IP:       e.IP,
+			IPv6:     e.IPv6,
+			Comment:  e.Comment,
+		})
 	}
-	return nil
+	return hapi, nil
+}
+
+// applyDistro makes a change to the /etc/hosts of a distro
+func (s *Service) applyDistro(c reconcile.Change) error {
+	switch c.Action {
+	case reconcile.Add:
+		return s.wsl.AddHostIP(c.Distro, c.Entry.Hostname, c.Entry.IP)
+	case reconcile.Update:
+		return s.wsl.UpdateHostIP(c.Distro, c.Entry.Hostname, c.Entry.IP)
+	}
+	return fmt.Errorf("unsupported change %s of %s", c.Action, c.Entry.Hostname)
 }
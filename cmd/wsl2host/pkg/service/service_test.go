@@ -0,0 +1,396 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/config"
+	"github.com/shayne/go-wsl2-host/pkg/dnsserver"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type testLog struct {
+	errors   []string
+	warnings []string
+}
+
+func (l *testLog) Error(eid uint32, msg string) error {
+	l.errors = append(l.errors, msg)
+	return nil
+}
+
+func (l *testLog) Warning(eid uint32, msg string) error {
+	l.warnings = append(l.warnings, msg)
+	return nil
+}
+
+func (l *testLog) Info(eid uint32, msg string) error { return nil }
+
+func fakeRunner() *wslcli.FakeRunner {
+	r := wslcli.NewFakeRunner()
+	r.SetUTF16("  NAME            STATE           VERSION\r\n"+
+		"* Ubuntu-18.04    Running         2\r\n"+
+		"  Debian          Stopped         2\r\n", "-l", "-v")
+	r.SetUTF16("Ubuntu-18.04\r\n", "-l", "-q", "--running")
+	r.SetDiscovery("Ubuntu-18.04", "ubuntu",
+		"Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n"+
+			"eth0\t00C012AC\t00000000\t0001\t0\t0\t0\t00F0FFFF\t0\t0\t0\n",
+		"Local:\n"+
+			"     +-- 172.18.192.0/20 2 0 2\n"+
+			"           |-- 172.18.192.5\n"+
+			"              /32 host LOCAL\n",
+		"20010db800000001021554fffe7b9a1c 02 40 00 00     eth0\n")
+	r.Set("app.local\n", "--", "bash", "-c", "cat ~/.wsl2hosts")
+	r.Set("127.0.0.1 localhost\n172.18.192.9 windows.local\n", "-d", "Ubuntu-18.04", "--", "cat", "/etc/hosts")
+	r.Set("", "-d", "Ubuntu-18.04", "--", "sed", "-i", "s/172.18.192.9 windows.local$/172.18.192.1 windows.local/g", "/etc/hosts")
+	return r
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"+
+		"172.18.192.7 debian.wsl    # managed by wsl2-host\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := fakeRunner()
+	elog := &testLog{}
+	s := New(elog, wslapi.New(wslcli.New(r)), testConfig(hostspath))
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	restarted := false
+	s.restartIPHelper = func() { restarted = true }
+
+	err = s.Run()
+	assert.Nil(t, err)
+	assert.Empty(t, elog.errors)
+	assert.True(t, restarted)
+
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.1 desktop1234.wsl    # host: DESKTOP-1234; managed by wsl2-host\r\n"+
+		"172.18.192.5 app.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c app.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c ubuntu1804.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n", string(b))
+
+	var sedCalls int
+	for _, c := range r.Calls {
+		if len(c) > 3 && c[3] == "sed" {
+			sedCalls++
+		}
+	}
+	assert.Equal(t, 1, sedCalls)
+
+	assert.Equal(t, []string{"ubuntu1804.wsl", "app.local"}, s.Reverse().Lookup("172.18.192.5"))
+	assert.Equal(t, []string{"ubuntu1804.wsl", "app.local"}, s.Reverse().Lookup("2001:db8:0:1:215:54ff:fe7b:9a1c"))
+	assert.Equal(t, []string{"desktop1234.wsl"}, s.Reverse().Lookup("172.18.192.1"))
+
+	// nothing changed, the hosts file is left alone
+	restarted = false
+	err = s.Run()
+	assert.Nil(t, err)
+	assert.False(t, restarted)
+}
+
+func testConfig(hostspath string) *config.Config {
+	cfg := config.Default()
+	cfg.HostsPath = hostspath
+	return cfg
+}
+
+func TestRunConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(hostspath)
+	cfg.TLD = "test"
+	cfg.Filter = "my-filter"
+	cfg.Aliases.File = ""
+	cfg.Aliases.Static = []string{"static.local"}
+	cfg.Targets.DistroHosts = false
+
+	r := fakeRunner()
+	s := New(&testLog{}, wslapi.New(wslcli.New(r)), cfg)
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() {}
+
+	err = s.Run()
+	assert.Nil(t, err)
+
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN my-filter\r\n"+
+		"172.18.192.1 desktop1234.test    # host: DESKTOP-1234; managed by wsl2-host\r\n"+
+		"172.18.192.5 static.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c static.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804.test    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c ubuntu1804.test    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"# END my-filter\r\n", string(b))
+
+	for _, c := range r.Calls {
+		assert.NotContains(t, c, "sed")
+		assert.NotContains(t, c, "cat ~/.wsl2hosts")
+	}
+}
+
+func TestPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := fakeRunner()
+	s := New(&testLog{}, wslapi.New(wslcli.New(r)), testConfig(hostspath))
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() { t.Error("IP Helper restarted") }
+	dns := dnsserver.New(".wsl", "")
+	s.SetDNS(dns)
+	assert.Nil(t, s.Publish())
+
+	req, err := (&dnsmessage.Message{Questions: []dnsmessage.Question{{
+		Name:  dnsmessage.MustNewName("ubuntu1804.wsl."),
+		Type:  dnsmessage.TypeA,
+		Class: dnsmessage.ClassINET,
+	}}}).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := dns.Handle(req)
+	assert.Nil(t, err)
+	var resp dnsmessage.Message
+	assert.Nil(t, resp.Unpack(out))
+	assert.Len(t, resp.Answers, 1)
+	assert.Equal(t, []string{"ubuntu1804.wsl"}, s.Reverse().Lookup("172.18.192.5")[:1])
+
+	// the hosts files are left alone
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\r\n", string(b))
+	for _, c := range r.Calls {
+		assert.NotContains(t, c, "sed")
+	}
+	assert.Nil(t, s.LastRun())
+}
+
+func TestSetConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(&testLog{}, wslapi.New(wslcli.New(fakeRunner())), testConfig(hostspath))
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() {}
+	err = s.Run()
+	assert.Nil(t, err)
+
+	cfg := testConfig(hostspath)
+	cfg.TLD = "dev"
+	cfg.Aliases.File = ""
+	s.SetConfig(cfg)
+	err = s.Run()
+	assert.Nil(t, err)
+
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.1 desktop1234.dev    # host: DESKTOP-1234; managed by wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804.dev    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c ubuntu1804.dev    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n", string(b))
+}
+
+func TestRunNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(hostspath)
+	cfg.Aliases.File = ""
+	cfg.Targets.DistroHosts = false
+	cfg.Names.Templates = []string{"{{.Name | slug}}.{{.TLD}}"}
+	cfg.Names.Distros = map[string][]string{
+		"Ubuntu-18.04": {"u18.dev.local", "{{.Name | slug}}.{{.TLD}}"},
+		"DESKTOP-1234": {"u18.dev.local"},
+	}
+
+	elog := &testLog{}
+	s := New(elog, wslapi.New(wslcli.New(fakeRunner())), cfg)
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() {}
+
+	err = s.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"hostname u18.dev.local is claimed by distro Ubuntu-18.04, Windows host DESKTOP-1234: given to none"}, elog.errors)
+
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.5 ubuntu-18-04.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c ubuntu-18-04.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n", string(b))
+}
+
+func TestRunCollisions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"+
+		"10.0.0.1 app.local\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(hostspath)
+	cfg.Targets.DistroHosts = false
+	cfg.Aliases.Static = []string{"ubuntu1804.wsl"}
+	cfg.Names.Collisions = "suffix"
+
+	elog := &testLog{}
+	s := New(elog, wslapi.New(wslcli.New(fakeRunner())), cfg)
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() {}
+
+	err = s.Run()
+	assert.Nil(t, err)
+	assert.Empty(t, elog.errors)
+	collisions := []string{
+		"hostname app.local is claimed by hosts file line 2, alias of Ubuntu-18.04: kept by hosts file line 2, app-ubuntu-18-04.local for alias of Ubuntu-18.04",
+		"hostname ubuntu1804.wsl is claimed by distro Ubuntu-18.04, alias of Ubuntu-18.04: kept by distro Ubuntu-18.04, ubuntu1804-ubuntu-18-04.wsl for alias of Ubuntu-18.04",
+	}
+	assert.Equal(t, collisions, elog.warnings)
+
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"10.0.0.1 app.local\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.1 desktop1234.wsl    # host: DESKTOP-1234; managed by wsl2-host\r\n"+
+		"172.18.192.5 app-ubuntu-18-04.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c app-ubuntu-18-04.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804-ubuntu-18-04.wsl    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c ubuntu1804-ubuntu-18-04.wsl    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"2001:db8:0:1:215:54ff:fe7b:9a1c ubuntu1804.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n", string(b))
+
+	// unchanged collisions are not logged again
+	err = s.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, collisions, elog.warnings)
+
+	found, err := s.Collisions()
+	assert.Nil(t, err)
+	assert.Len(t, found, 2)
+}
+
+func TestReverseLookup(t *testing.T) {
+	s := New(&testLog{}, wslapi.New(wslcli.New(fakeRunner())), testConfig(""))
+	names, err := s.ReverseLookup("2001:db8:0:1:215:54ff:fe7b:9a1c")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ubuntu1804.wsl", "app.local"}, names)
+
+	names, err = s.ReverseLookup("10.0.0.1")
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+
+	_, err = s.ReverseLookup("not-an-ip")
+	assert.NotNil(t, err)
+}
+
+func TestBuildReverseMap(t *testing.T) {
+	r := BuildReverseMap([]*wslapi.DistroInfo{
+		{Name: "Ubuntu-18.04", Running: true, Default: true, IP: "172.18.192.5", IPv4: []string{"172.18.192.5"},
+			IPv6: []string{"fe80::215:54ff:fe7b:9a1c"}},
+		{Name: "Legacy", Running: true, IP: "127.0.0.1", IPv4: []string{"127.0.0.1"}},
+		{Name: "Alpine", Running: true, IP: "127.0.0.1", IPv4: []string{"127.0.0.1"}},
+		{Name: "Debian"},
+	}, map[string][]string{
+		"Ubuntu-18.04": {"ubuntu1804.wsl"},
+		"Legacy":       {"legacy.wsl"},
+		"Alpine":       {"alpine.wsl"},
+		"Debian":       {"debian.wsl"},
+	}, []string{"web.local", "", "api.local"})
+	// WSL 1 distros share the loopback address, link-local
+	// addresses are not unique
+	assert.Equal(t, ReverseMap{
+		"172.18.192.5": {"ubuntu1804.wsl", "api.local", "web.local"},
+	}, r)
+}
+
+func TestBuildReverseMapNATDocker(t *testing.T) {
+	sample := filepath.Join("..", "..", "..", "..", "pkg", "wslcli", "testdata", "net", "nat-docker")
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(sample, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	r := wslcli.NewFakeRunner()
+	r.SetDiscovery("Ubuntu", "ubuntu", read("route"), read("fib_trie"), "")
+	wsl := wslapi.New(wslcli.New(r))
+	wsl.SetWSLConfig("")
+	info := &wslapi.DistroInfo{Name: "Ubuntu", Running: true, Default: true, Version: 2}
+	assert.Nil(t, wsl.GetAddresses(info))
+
+	// docker0 and the bridge of compose are not the distro
+	rm := BuildReverseMap([]*wslapi.DistroInfo{info},
+		map[string][]string{"Ubuntu": {"ubuntu.wsl"}}, []string{"app.local"})
+	assert.Equal(t, ReverseMap{
+		"172.29.86.123": {"ubuntu.wsl", "app.local"},
+	}, rm)
+}
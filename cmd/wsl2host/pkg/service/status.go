@@ -0,0 +1,248 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/pkg/hostsapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// RunState is the outcome of a Run, recorded for status
+type RunState struct {
+	Time time.Time `json:"time"`
+	// Changes is the number of changes the run made, those
+	// that failed left out
+	Changes int `json:"changes"`
+	// ChangeSet are the changes the run made or tried to, with
+	// their outcome
+	ChangeSet []ChangeResult `json:"changeset,omitempty"`
+	// Error is the failure of the run or of the Windows hosts file
+	Error string `json:"error,omitempty"`
+	// Distros are the errors of the distros, keyed by name
+	Distros map[string]string `json:"distros,omitempty"`
+}
+
+// ChangeResult is a change of a run and its outcome
+type ChangeResult struct {
+	reconcile.Change
+	// Error is why the change failed, empty when it was made
+	Error string `json:"error,omitempty"`
+}
+
+func newChangeResult(c reconcile.Change, err error) ChangeResult {
+	r := ChangeResult{Change: c}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Failed returns the changes of the run that failed
+func (st *RunState) Failed() []ChangeResult {
+	var failed []ChangeResult
+	for _, c := range st.ChangeSet {
+		if c.Error != "" {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// SetStatePath makes Run record its outcome in the file at path
+func (s *Service) SetStatePath(path string) {
+	s.statepath = path
+}
+
+// LastRun returns the outcome of the last Run, nil before the
+// first one
+func (s *Service) LastRun() *RunState {
+	return s.last
+}
+
+// saveState keeps the outcome of a run and records it when a
+// state path is set, failures to do so being logged
+func (s *Service) saveState(results []ChangeResult, errs *runErrors, err error) {
+	st := &RunState{Time: s.now(), ChangeSet: results}
+	for _, r := range results {
+		if r.Error == "" {
+			st.Changes++
+		}
+	}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	if errs != nil {
+		if errs.windows != nil {
+			st.Error = errs.windows.Error()
+		}
+		for name, err := range errs.distros {
+			if st.Distros == nil {
+				st.Distros = make(map[string]string)
+			}
+			st.Distros[name] = err.Error()
+		}
+	}
+	s.last = st
+	if s.statepath == "" {
+		return
+	}
+
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.statepath), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(s.statepath, b, 0644)
+	}
+	if err != nil {
+		s.elog.Warning(1, fmt.Sprintf("failed to record run state: %v", err))
+	}
+}
+
+// LoadRunState reads the state recorded at path, nil when no
+// run was recorded yet
+func LoadRunState(path string) (*RunState, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &RunState{}
+	err = json.Unmarshal(b, st)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run state %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// DistroStatus describes a discovered distro
+type DistroStatus struct {
+	Name      string   `json:"name"`
+	State     string   `json:"state"`
+	Version   int      `json:"version"`
+	Default   bool     `json:"default"`
+	IPv4      []string `json:"ipv4"`
+	IPv6      []string `json:"ipv6"`
+	Hostnames []string `json:"hostnames"`
+	Aliases   []string `json:"aliases,omitempty"`
+	ID        string   `json:"id,omitempty"`
+	// Interfaces, Hostname, DefaultUser, NetworkingMode, Kernel
+	// and BootTime are only known of the running distros
+	Interfaces     []wslapi.Interface `json:"interfaces,omitempty"`
+	Hostname       string             `json:"hostname,omitempty"`
+	DefaultUser    string             `json:"default_user,omitempty"`
+	NetworkingMode string             `json:"networking_mode,omitempty"`
+	Kernel         string             `json:"kernel,omitempty"`
+	BootTime       *time.Time         `json:"boot_time,omitempty"`
+	// LastSeen is when the distro was last found running, as far
+	// as the service knows
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+	// Error is why the distro could not be discovered, else its
+	// error in the last run
+	Error string `json:"error,omitempty"`
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Status is what the service knows of the distros and the
+// Windows hosts file
+type Status struct {
+	Distros []*DistroStatus `json:"distros"`
+	// HostsPath is the Windows hosts file
+	HostsPath string `json:"hosts_path"`
+	// Managed are the managed entries of the Windows hosts file
+	Managed []reconcile.Entry `json:"managed"`
+	// LastRun is the outcome of the last recorded run, nil
+	// when none was recorded
+	LastRun *RunState `json:"last_run"`
+	// Paused are the targets left alone until resumed
+	Paused []reconcile.Target `json:"paused,omitempty"`
+}
+
+// Status discovers the distros and reads the managed entries
+// of the Windows hosts file and the state of the last run
+func (s *Service) Status() (*Status, error) {
+	infos, err := s.wsl.GetAllInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get infos: %w", err)
+	}
+	hn, err := s.resolveNames(infos)
+	if err != nil {
+		return nil, fmt.Errorf("failed to name distros: %w", err)
+	}
+
+	st := &Status{
+		HostsPath: s.cfg.HostsPath,
+		Managed:   []reconcile.Entry{},
+		LastRun:   s.last,
+		Paused:    s.Paused(),
+	}
+	if st.LastRun == nil && s.statepath != "" {
+		st.LastRun, err = LoadRunState(s.statepath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range infos {
+		d := &DistroStatus{
+			Name:      i.Name,
+			State:     i.State,
+			Version:   i.Version,
+			Default:   i.Default,
+			IPv4:      i.IPv4,
+			IPv6:      i.IPv6,
+			Hostnames: hn.names[i.Name],
+			ID:        i.ID,
+
+			Interfaces:     i.Interfaces,
+			Hostname:       i.Hostname,
+			DefaultUser:    i.DefaultUser,
+			NetworkingMode: i.NetworkingMode,
+			Kernel:         i.Kernel,
+			BootTime:       timeOrNil(i.BootTime),
+			LastSeen:       timeOrNil(i.LastSeen),
+			Error:          i.Error,
+		}
+		if d.State == "" {
+			d.State = wslapi.StateStopped
+			if i.Running {
+				d.State = wslapi.StateRunning
+			}
+		}
+		if i.Default && i.Running {
+			d.Aliases = hn.aliases
+		}
+		if st.LastRun != nil && d.Error == "" {
+			d.Error = st.LastRun.Distros[i.Name]
+		}
+		st.Distros = append(st.Distros, d)
+	}
+
+	hapi, err := hostsapi.CreateAPI(s.cfg.HostsPath, s.cfg.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hosts api: %w", err)
+	}
+	defer hapi.Close()
+	for hostname, he := range hapi.Entries() {
+		st.Managed = append(st.Managed, reconcile.Entry{Hostname: hostname, IP: he.IP, IPv6: he.IPv6, Comment: he.Comment})
+	}
+	sort.Slice(st.Managed, func(a, b int) bool {
+		return st.Managed[a].Hostname < st.Managed[b].Hostname
+	})
+	return st, nil
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/cmd/wsl2host/pkg/reconcile"
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRunStateMissing(t *testing.T) {
+	st, err := LoadRunState(filepath.Join(os.TempDir(), "wsl2host-does-not-exist.json"))
+	assert.Nil(t, err)
+	assert.Nil(t, st)
+}
+
+func TestStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := fakeRunner()
+	r.SetError(errors.New("sed failed"), "-d", "Ubuntu-18.04", "--", "sed", "-i", "s/172.18.192.9 windows.local$/172.18.192.1 windows.local/g", "/etc/hosts")
+	elog := &testLog{}
+	wsl := wslapi.New(wslcli.New(r))
+	wsl.SetRegistry(nil)
+	wsl.SetWSLConfig("")
+	s := New(elog, wsl, testConfig(hostspath))
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() {}
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	st, err := s.Status()
+	assert.Nil(t, err)
+	assert.Nil(t, st.LastRun, "no state path")
+
+	s.SetStatePath(filepath.Join(dir, "state", "state.json"))
+	st, err = s.Status()
+	assert.Nil(t, err)
+	assert.Nil(t, st.LastRun, "no run yet")
+
+	err = s.Run()
+	assert.NotNil(t, err)
+
+	st, err = s.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, hostspath, st.HostsPath)
+	if assert.NotNil(t, st.LastRun) {
+		assert.True(t, now.Equal(st.LastRun.Time))
+		// the update of the /etc/hosts of Ubuntu failed
+		assert.Equal(t, 3, st.LastRun.Changes)
+		assert.Len(t, st.LastRun.ChangeSet, 4)
+		if failed := st.LastRun.Failed(); assert.Len(t, failed, 1) {
+			assert.Equal(t, "Ubuntu-18.04", failed[0].Distro)
+			assert.Equal(t, "sed failed", failed[0].Error)
+		}
+		assert.Empty(t, st.LastRun.Error)
+	}
+	// found at the time of the wsl.exe commands
+	ubuntu := st.Distros[0]
+	if assert.NotNil(t, ubuntu.BootTime) && assert.NotNil(t, ubuntu.LastSeen) {
+		// the boot time being rounded to the second
+		assert.InDelta(t, time.Hour.Seconds(), ubuntu.LastSeen.Sub(*ubuntu.BootTime).Seconds(), 1)
+	}
+	ubuntu.BootTime, ubuntu.LastSeen = nil, nil
+	assert.Equal(t, []*DistroStatus{
+		{
+			Name:      "Ubuntu-18.04",
+			State:     "Running",
+			Version:   2,
+			Default:   true,
+			IPv4:      []string{"172.18.192.5"},
+			IPv6:      []string{"2001:db8:0:1:215:54ff:fe7b:9a1c"},
+			Hostnames: []string{"ubuntu1804.wsl"},
+			Aliases:   []string{"app.local"},
+			Interfaces: []wslapi.Interface{{Name: "eth0", IPv4: []string{"172.18.192.5"},
+				IPv6: []string{"2001:db8:0:1:215:54ff:fe7b:9a1c"}}},
+			Hostname:       "ubuntu",
+			DefaultUser:    wslcli.FakeUser,
+			NetworkingMode: wslapi.NetworkingNAT,
+			Kernel:         wslcli.FakeKernel,
+			Error:          "sed failed",
+		},
+		{
+			Name:      "Debian",
+			State:     "Stopped",
+			Version:   2,
+			Hostnames: []string{"debian.wsl"},
+		},
+	}, st.Distros)
+	assert.Equal(t, []reconcile.Entry{
+		{Hostname: "app.local", IP: "172.18.192.5", IPv6: "2001:db8:0:1:215:54ff:fe7b:9a1c", Comment: "alias: Ubuntu-18.04; managed by wsl2-host"},
+		{Hostname: "desktop1234.wsl", IP: "172.18.192.1", Comment: "host: DESKTOP-1234; managed by wsl2-host"},
+		{Hostname: "ubuntu1804.wsl", IP: "172.18.192.5", IPv6: "2001:db8:0:1:215:54ff:fe7b:9a1c", Comment: "distro: Ubuntu-18.04; managed by wsl2-host"},
+	}, st.Managed)
+}
+
+func TestRunPaused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsl2host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hostspath := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(hostspath, []byte("127.0.0.1 localhost\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := fakeRunner()
+	s := New(&testLog{}, wslapi.New(wslcli.New(r)), testConfig(hostspath))
+	s.hostIP = func() (string, error) { return "172.18.192.1", nil }
+	s.hostname = func() (string, error) { return "DESKTOP-1234", nil }
+	s.restartIPHelper = func() {}
+
+	assert.EqualError(t, s.SetPaused("nowhere", true), `unknown target "nowhere"`)
+	assert.Nil(t, s.SetPaused(reconcile.WindowsHosts, true))
+	assert.Nil(t, s.SetPaused(reconcile.DistroHosts, true))
+	assert.Equal(t, []reconcile.Target{reconcile.DistroHosts, reconcile.WindowsHosts}, s.Paused())
+
+	err = s.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, s.LastRun().Changes)
+	b, err := ioutil.ReadFile(hostspath)
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1 localhost\r\n", string(b))
+
+	assert.Nil(t, s.SetPaused(reconcile.WindowsHosts, false))
+	st, err := s.Status()
+	assert.Nil(t, err)
+	assert.Equal(t, []reconcile.Target{reconcile.DistroHosts}, st.Paused)
+
+	err = s.Run()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, s.LastRun().Changes)
+	for _, c := range r.Calls {
+		assert.NotContains(t, c, "sed")
+	}
+}
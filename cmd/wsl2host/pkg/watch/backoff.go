@@ -0,0 +1,32 @@
+package watch
+
+import "time"
+
+// Backoff is the time between two polls, doubling from Min up
+// to Max while polls find nothing and back to Min on a change
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	cur time.Duration
+}
+
+// Next returns the time until the next poll, after a poll that
+// found changes or not
+func (b *Backoff) Next(changed bool) time.Duration {
+	switch {
+	case changed || b.cur < b.Min:
+		b.cur = b.Min
+	default:
+		b.cur *= 2
+	}
+	if b.cur > b.Max {
+		b.cur = b.Max
+	}
+	return b.cur
+}
+
+// Reset makes the next poll come after Min
+func (b *Backoff) Reset() {
+	b.cur = 0
+}
@@ -0,0 +1,207 @@
+// Package watch detects changes of the WSL distros from cheap
+// snapshots of their state, telling when the hosts files need
+// an update
+package watch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+)
+
+// Type is the kind of an Event
+type Type string
+
+const (
+	// Started is a distro found running
+	Started Type = "started"
+	// Stopped is a running distro found stopped or gone
+	Stopped Type = "stopped"
+	// IPChanged is a running distro whose addresses changed
+	IPChanged Type = "ip-changed"
+	// DefaultChanged is another distro becoming the default one
+	DefaultChanged Type = "default-changed"
+	// AliasesChanged is a change of the alias file of the default
+	// distro
+	AliasesChanged Type = "aliases-changed"
+	// Resync is the periodic full check, catching what happens
+	// outside of WSL such as edits of the hosts files
+	Resync Type = "resync"
+)
+
+// Event is a change found by a Watcher
+type Event struct {
+	Type Type
+	// Distro is the distro that changed, empty for Resync
+	Distro string
+	// Old and New describe the change: the addresses, the
+	// default distro or the aliases
+	Old string
+	New string
+}
+
+func (e Event) String() string {
+	switch e.Type {
+	case Started, Stopped:
+		return fmt.Sprintf("distro %s %s", e.Distro, e.Type)
+	case Resync:
+		return "periodic resync"
+	}
+	return fmt.Sprintf("%s of %s: %q -> %q", e.Type, e.Distro, e.Old, e.New)
+}
+
+// Watcher lists the distros on every Poll, a single wsl.exe
+// command, and only looks up the addresses of the distros
+// found started
+// Everything is checked again every resync interval
+type Watcher struct {
+	wsl       *wslapi.API
+	aliasFile string
+	resync    time.Duration
+	now       func() time.Time
+
+	distros    map[string]*wslapi.DistroInfo
+	def        string
+	aliases    []string
+	lastResync time.Time
+}
+
+// New creates a Watcher of the distros listed by wsl, reading
+// the aliases of the default distro from aliasFile unless empty
+// and checking everything every resync
+func New(wsl *wslapi.API, aliasFile string, resync time.Duration) *Watcher {
+	return &Watcher{wsl: wsl, aliasFile: aliasFile, resync: resync, now: time.Now}
+}
+
+// SetAliasFile changes the alias file of the default distro
+func (w *Watcher) SetAliasFile(file string) {
+	w.aliasFile = file
+}
+
+// SetResync changes the time between two full checks
+func (w *Watcher) SetResync(resync time.Duration) {
+	w.resync = resync
+}
+
+// Distros returns the distros as of the last Poll
+func (w *Watcher) Distros() []*wslapi.DistroInfo {
+	var infos []*wslapi.DistroInfo
+	for _, info := range w.distros {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(a, b int) bool { return infos[a].Name < infos[b].Name })
+	return infos
+}
+
+func addresses(info *wslapi.DistroInfo) string {
+	return strings.Join(append(append([]string{}, info.IPv4...), info.IPv6...), ",")
+}
+
+// keepDetails copies what the last Poll found of a distro still
+// running to info, only its list fields being new
+func keepDetails(info, old *wslapi.DistroInfo) {
+	listed := *info
+	*info = *old
+	info.Running = listed.Running
+	info.State = listed.State
+	info.Version = listed.Version
+	info.Default = listed.Default
+	info.LastSeen = listed.LastSeen
+}
+
+// Poll compares the distros with the last Poll, the first one
+// reporting every running distro as started
+// The state is left as it was when the distros cannot be
+// listed, the changes being reported by the next Poll
+// A running distro whose addresses cannot be found is recorded
+// with its Error, and checked again by every Poll until found
+func (w *Watcher) Poll() ([]Event, error) {
+	now := w.now()
+	resync := w.distros == nil || now.Sub(w.lastResync) >= w.resync
+
+	infos, err := w.wsl.ListDistros()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	distros := make(map[string]*wslapi.DistroInfo)
+	var def *wslapi.DistroInfo
+	for _, info := range infos {
+		old := w.distros[info.Name]
+		running := old != nil && old.Running
+		switch {
+		case info.Running && (!running || resync || old.Error != ""):
+			err = w.wsl.GetAddresses(info)
+			switch {
+			case err != nil && running:
+				// checked again by the next Poll, the run of the
+				// service leaving its entries alone meanwhile
+				keepDetails(info, old)
+				info.Error = err.Error()
+			case !running:
+				events = append(events, Event{Type: Started, Distro: info.Name, New: addresses(info)})
+			case addresses(old) != addresses(info) || old.Error != "":
+				events = append(events, Event{Type: IPChanged, Distro: info.Name, Old: addresses(old), New: addresses(info)})
+			}
+		case info.Running:
+			keepDetails(info, old)
+		case running:
+			events = append(events, Event{Type: Stopped, Distro: info.Name, Old: addresses(old)})
+		}
+		if !info.Running && old != nil {
+			info.LastSeen = old.LastSeen
+		}
+		if info.Default {
+			def = info
+		}
+		distros[info.Name] = info
+	}
+	var gone []string
+	for name, old := range w.distros {
+		if _, exists := distros[name]; !exists && old.Running {
+			gone = append(gone, name)
+		}
+	}
+	sort.Strings(gone)
+	for _, name := range gone {
+		events = append(events, Event{Type: Stopped, Distro: name, Old: addresses(w.distros[name])})
+	}
+
+	var defName string
+	var aliases []string
+	if def != nil {
+		defName = def.Name
+	}
+	if w.distros != nil && defName != w.def {
+		events = append(events, Event{Type: DefaultChanged, Distro: defName, Old: w.def, New: defName})
+	}
+	if def != nil && def.Running && w.aliasFile != "" {
+		old := w.distros[defName]
+		started := old == nil || !old.Running
+		if resync || started || defName != w.def {
+			// a missing or empty file leaves no aliases
+			aliases, _ = w.wsl.GetHostAliasesFrom(w.aliasFile)
+			if strings.Join(aliases, " ") != strings.Join(w.aliases, " ") {
+				events = append(events, Event{Type: AliasesChanged, Distro: defName,
+					Old: strings.Join(w.aliases, " "), New: strings.Join(aliases, " ")})
+			}
+		} else {
+			aliases = w.aliases
+		}
+	}
+
+	if resync {
+		if w.distros != nil {
+			events = append(events, Event{Type: Resync})
+		}
+		w.lastResync = now
+	}
+	w.distros = distros
+	w.def = defName
+	w.aliases = aliases
+	return events, nil
+}
@@ -0,0 +1,186 @@
+package watch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/pkg/wslapi"
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+)
+
+const route = "Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n" +
+	"eth0\t00C012AC\t00000000\t0001\t0\t0\t0\t00F0FFFF\t0\t0\t0\n"
+
+func fibTrie(ip string) string {
+	return "Local:\n" +
+		"     +-- 172.18.192.0/20 2 0 2\n" +
+		"           |-- " + ip + "\n" +
+		"              /32 host LOCAL\n"
+}
+
+func setList(r *wslcli.FakeRunner, lines ...string) {
+	out := "  NAME            STATE           VERSION\r\n"
+	for _, l := range lines {
+		out += l + "\r\n"
+	}
+	r.SetUTF16(out, "-l", "-v")
+}
+
+func setDistro(r *wslcli.FakeRunner, name, ip string) {
+	r.SetDiscovery(name, strings.ToLower(name), route, fibTrie(ip), "")
+}
+
+func TestPoll(t *testing.T) {
+	r := wslcli.NewFakeRunner()
+	setList(r, "* Ubuntu    Running    2", "  Debian    Stopped    2")
+	setDistro(r, "Ubuntu", "172.18.192.5")
+	setDistro(r, "Debian", "172.18.192.5")
+	r.Set("app.local\n", "--", "bash", "-c", "cat ~/.wsl2hosts")
+
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	w := New(wslapi.New(wslcli.New(r)), "~/.wsl2hosts", time.Minute)
+	w.now = func() time.Time { return now }
+
+	events, err := w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{Type: Started, Distro: "Ubuntu", New: "172.18.192.5"},
+		{Type: AliasesChanged, Distro: "Ubuntu", New: "app.local"},
+	}, events)
+	assert.Equal(t, "172.18.192.5", w.Distros()[1].IP)
+
+	// nothing changed, a single wsl.exe command
+	calls := len(r.Calls)
+	now = now.Add(5 * time.Second)
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+	assert.Equal(t, calls+1, len(r.Calls))
+	assert.Equal(t, "172.18.192.5", w.Distros()[1].IP, "addresses are kept")
+	assert.Equal(t, wslcli.FakeKernel, w.Distros()[1].Kernel, "details are kept")
+	seen := w.Distros()[1].LastSeen
+	assert.False(t, seen.IsZero())
+
+	setList(r, "* Ubuntu    Stopped    2", "  Debian    Running    2")
+	now = now.Add(5 * time.Second)
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{Type: Stopped, Distro: "Ubuntu", Old: "172.18.192.5"},
+		{Type: Started, Distro: "Debian", New: "172.18.192.5"},
+	}, events)
+	assert.Equal(t, seen, w.Distros()[1].LastSeen, "when stopped distros were last seen is kept")
+
+	setList(r, "  Ubuntu    Stopped    2", "* Debian    Running    2")
+	r.Set("api.local\n", "--", "bash", "-c", "cat ~/.wsl2hosts")
+	now = now.Add(5 * time.Second)
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{Type: DefaultChanged, Distro: "Debian", Old: "Ubuntu", New: "Debian"},
+		{Type: AliasesChanged, Distro: "Debian", New: "api.local"},
+	}, events)
+
+	// the addresses are only checked again on resync
+	setDistro(r, "Debian", "172.18.192.9")
+	now = now.Add(5 * time.Second)
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+	now = now.Add(time.Minute)
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{Type: IPChanged, Distro: "Debian", Old: "172.18.192.5", New: "172.18.192.9"},
+		{Type: Resync},
+	}, events)
+
+	// unregistered while running
+	setList(r, "* Ubuntu    Stopped    2")
+	now = now.Add(5 * time.Second)
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{Type: Stopped, Distro: "Debian", Old: "172.18.192.9"},
+		{Type: DefaultChanged, Distro: "Ubuntu", Old: "Debian", New: "Ubuntu"},
+	}, events)
+}
+
+func TestPollFailure(t *testing.T) {
+	r := wslcli.NewFakeRunner()
+	w := New(wslapi.New(wslcli.New(r)), "", time.Minute)
+
+	// the distros cannot be listed
+	_, err := w.Poll()
+	assert.NotNil(t, err)
+
+	// the addresses of Debian cannot be read yet
+	setList(r, "* Ubuntu    Running    2", "  Debian    Running    2")
+	setDistro(r, "Ubuntu", "172.18.192.5")
+	events, err := w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{
+		{Type: Started, Distro: "Ubuntu", New: "172.18.192.5"},
+		{Type: Started, Distro: "Debian"},
+	}, events)
+	debian := w.Distros()[0]
+	assert.Equal(t, "Debian", debian.Name)
+	assert.True(t, debian.Running)
+	assert.NotEmpty(t, debian.Error)
+	assert.Empty(t, w.Distros()[1].Error)
+
+	// checked again until found
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+	assert.NotEmpty(t, w.Distros()[0].Error)
+
+	setDistro(r, "Debian", "172.18.192.6")
+	events, err = w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{{Type: IPChanged, Distro: "Debian", New: "172.18.192.6"}}, events)
+	assert.Empty(t, w.Distros()[0].Error)
+}
+
+func TestPollFailureRunning(t *testing.T) {
+	r := wslcli.NewFakeRunner()
+	setList(r, "* Ubuntu    Running    2")
+	setDistro(r, "Ubuntu", "172.18.192.5")
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	w := New(wslapi.New(wslcli.New(r)), "", time.Minute)
+	w.now = func() time.Time { return now }
+	_, err := w.Poll()
+	assert.Nil(t, err)
+
+	// failing on resync, what was found is kept
+	r.SetDiscovery("Ubuntu", "ubuntu", "", "", "")
+	now = now.Add(time.Minute)
+	events, err := w.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, []Event{{Type: Resync}}, events)
+	assert.Equal(t, "172.18.192.5", w.Distros()[0].IP)
+	assert.NotEmpty(t, w.Distros()[0].Error)
+}
+
+func TestEventString(t *testing.T) {
+	assert.Equal(t, "distro Ubuntu started", Event{Type: Started, Distro: "Ubuntu"}.String())
+	assert.Equal(t, `ip-changed of Debian: "172.18.192.5" -> "172.18.192.9"`,
+		Event{Type: IPChanged, Distro: "Debian", Old: "172.18.192.5", New: "172.18.192.9"}.String())
+}
+
+func TestBackoff(t *testing.T) {
+	b := &Backoff{Min: 5 * time.Second, Max: time.Minute}
+	var got []time.Duration
+	for _, changed := range []bool{false, false, false, false, false, false, true, false} {
+		got = append(got, b.Next(changed))
+	}
+	assert.Equal(t, []time.Duration{
+		5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second,
+		time.Minute, time.Minute, 5 * time.Second, 10 * time.Second,
+	}, got)
+
+	b.Reset()
+	assert.Equal(t, 5*time.Second, b.Next(false))
+}
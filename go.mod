@@ -3,8 +3,10 @@ module github.com/shayne/go-wsl2-host
 go 1.14
 
 require (
+	github.com/Microsoft/go-winio v0.4.14
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/crypto v0.0.0-20190621222207-cc06ce4a13d4
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
 	golang.org/x/sys v0.0.0-20190626221950-04f50cda93cb
 	golang.org/x/text v0.3.0
 )
@@ -0,0 +1,150 @@
+// Package diff produces unified diffs of small text files
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines around changes
+const context = 3
+
+// splitLines splits text into lines without their line ending
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// edits returns the edit script turning a into b from their
+// longest common subsequence
+func edits(a, b []string) []op {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+	return ops
+}
+
+// hunkRange formats the start and length of a hunk side
+func hunkRange(start, length int) string {
+	if length == 0 {
+		// empty ranges point at the line before
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// Unified returns the unified diff turning a, named aName, into
+// b, named bName, or "" when they have the same lines
+// Line endings are ignored
+func Unified(aName, bName, a, b string) string {
+	ops := edits(splitLines(a), splitLines(b))
+
+	// group changes closer than two contexts into hunks
+	var hunks [][2]int
+	for idx, o := range ops {
+		if o.kind == ' ' {
+			continue
+		}
+		start := idx - context
+		if start < 0 {
+			start = 0
+		}
+		end := idx + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+		if n := len(hunks); n > 0 && start <= hunks[n-1][1] {
+			hunks[n-1][1] = end
+		} else {
+			hunks = append(hunks, [2]int{start, end})
+		}
+	}
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", aName, bName)
+	aline, bline, pos := 1, 1, 0
+	for _, h := range hunks {
+		for ; pos < h[0]; pos++ {
+			aline, bline = advance(ops[pos], aline, bline)
+		}
+		var alen, blen int
+		for _, o := range ops[h[0]:h[1]] {
+			if o.kind != '+' {
+				alen++
+			}
+			if o.kind != '-' {
+				blen++
+			}
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(aline, alen), hunkRange(bline, blen))
+		for ; pos < h[1]; pos++ {
+			o := ops[pos]
+			fmt.Fprintf(&buf, "%c%s\n", o.kind, o.line)
+			aline, bline = advance(o, aline, bline)
+		}
+	}
+	return buf.String()
+}
+
+func advance(o op, aline, bline int) (int, int) {
+	if o.kind != '+' {
+		aline++
+	}
+	if o.kind != '-' {
+		bline++
+	}
+	return aline, bline
+}
@@ -0,0 +1,52 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedSame(t *testing.T) {
+	assert.Equal(t, "", Unified("a", "b", "x\r\ny\r\n", "x\ny\n"))
+	assert.Equal(t, "", Unified("a", "b", "", ""))
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n"
+	assert.Equal(t, "--- a/hosts\n"+
+		"+++ b/hosts\n"+
+		"@@ -1,6 +1,6 @@\n"+
+		" 1\n"+
+		" 2\n"+
+		"-3\n"+
+		"+three\n"+
+		" 4\n"+
+		" 5\n"+
+		" 6\n"+
+		"@@ -13,3 +13,4 @@\n"+
+		" 13\n"+
+		" 14\n"+
+		" 15\n"+
+		"+16\n", Unified("a/hosts", "b/hosts", a, b))
+}
+
+func TestUnifiedMergesHunks(t *testing.T) {
+	assert.Equal(t, "--- a\n"+
+		"+++ b\n"+
+		"@@ -1,8 +1,7 @@\n"+
+		"-1\n"+
+		" 2\n"+
+		" 3\n"+
+		" 4\n"+
+		" 5\n"+
+		" 6\n"+
+		" 7\n"+
+		"-8\n"+
+		"+eight\n", Unified("a", "b", "1\n2\n3\n4\n5\n6\n7\n8\n", "2\n3\n4\n5\n6\n7\neight\n"))
+}
+
+func TestUnifiedEmptySide(t *testing.T) {
+	assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n", Unified("a", "b", "", "x\ny\n"))
+	assert.Equal(t, "--- a\n+++ b\n@@ -1 +0,0 @@\n-x\n", Unified("a", "b", "x\n", ""))
+}
@@ -0,0 +1,148 @@
+// Package naming turns distro names into hostnames
+// using text/template
+package naming
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate names distros the way wsl2host always did,
+// "Ubuntu-18.04" becoming "ubuntu1804.wsl"
+const DefaultTemplate = "{{.Name | compact}}.{{.TLD}}"
+
+var nonalnum = regexp.MustCompile("[^a-z0-9]+")
+
+// compact lowercases s and strips anything not alphanumeric,
+// "Ubuntu-18.04" => "ubuntu1804"
+func compact(s string) string {
+	return nonalnum.ReplaceAllString(strings.ToLower(s), "")
+}
+
+// slug lowercases s and replaces runs of non alphanumeric
+// characters with dashes, "Ubuntu-18.04" => "ubuntu-18-04"
+func slug(s string) string {
+	return strings.Trim(nonalnum.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+var funcs = template.FuncMap{
+	"compact": compact,
+	"slug":    slug,
+	"lower":   strings.ToLower,
+}
+
+var labelreg = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidHostname checks name is a RFC 1123 hostname
+func ValidHostname(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("empty hostname")
+	}
+	if len(name) > 253 {
+		return fmt.Errorf("hostname too long: %s", name)
+	}
+	for _, label := range strings.Split(strings.ToLower(name), ".") {
+		if !labelreg.MatchString(label) {
+			return fmt.Errorf("invalid hostname: %q", name)
+		}
+	}
+	return nil
+}
+
+// Distro is the data available to templates
+type Distro struct {
+	// Name of the distro, or of the Windows host
+	Name string
+	// TLD without its leading dot, e.g. "wsl"
+	TLD     string
+	Version int
+	Default bool
+	// ID is the GUID of the distro in braces, when known
+	ID string
+	// Hostname, User, NetworkingMode and Kernel are found in
+	// running WSL 2 distros, empty otherwise
+	Hostname       string
+	User           string
+	NetworkingMode string
+	Kernel         string
+}
+
+// Namer gives hostnames to distros
+type Namer struct {
+	tld       string
+	templates []*template.Template
+	overrides map[string][]*template.Template
+}
+
+func parse(texts []string) ([]*template.Template, error) {
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("no templates")
+	}
+	var tmpls []*template.Template
+	for _, text := range texts {
+		t, err := template.New(text).Funcs(funcs).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %q: %w", text, err)
+		}
+		tmpls = append(tmpls, t)
+	}
+	return tmpls, nil
+}
+
+// New creates a Namer naming every distro with templates, except
+// for the distros of overrides which use their own templates
+func New(tld string, templates []string, overrides map[string][]string) (*Namer, error) {
+	n := &Namer{
+		tld:       strings.Trim(tld, "."),
+		overrides: make(map[string][]*template.Template),
+	}
+	var err error
+	n.templates, err = parse(templates)
+	if err != nil {
+		return nil, err
+	}
+	for distro, texts := range overrides {
+		n.overrides[distro], err = parse(texts)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", distro, err)
+		}
+	}
+	return n, nil
+}
+
+// Names returns the hostnames of d in template order, templates
+// rendering nothing giving none
+func (n *Namer) Names(d Distro) ([]string, error) {
+	d.TLD = n.tld
+	tmpls, ok := n.overrides[d.Name]
+	if !ok {
+		tmpls = n.templates
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range tmpls {
+		var buf bytes.Buffer
+		err := t.Execute(&buf, d)
+		if err != nil {
+			return nil, fmt.Errorf("template %q failed for %s: %w", t.Name(), d.Name, err)
+		}
+		name := strings.ToLower(strings.TrimSpace(buf.String()))
+		if name == "" {
+			// e.g. {{if .Default}} without else, the template
+			// not applying to d
+			continue
+		}
+		err = ValidHostname(name)
+		if err != nil {
+			return nil, fmt.Errorf("template %q for %s: %w", t.Name(), d.Name, err)
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,89 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuncs(t *testing.T) {
+	assert.Equal(t, "ubuntu1804", compact("Ubuntu-18.04"))
+	assert.Equal(t, "ubuntu-18-04", slug("Ubuntu-18.04"))
+	assert.Equal(t, "opensuse-leap-15-2", slug("openSUSE-Leap-15.2_"))
+}
+
+func TestValidHostname(t *testing.T) {
+	for _, name := range []string{"ubuntu1804.wsl", "u18.dev.local", "a", "x-1.wsl"} {
+		assert.Nil(t, ValidHostname(name), name)
+	}
+	for _, name := range []string{"", ".wsl", "-a.wsl", "a-.wsl", "a_b.wsl", "a..wsl", "ubuntu 18.wsl"} {
+		assert.NotNil(t, ValidHostname(name), name)
+	}
+}
+
+func TestNames(t *testing.T) {
+	n, err := New(".wsl", []string{DefaultTemplate, "{{.Name | slug}}.{{.TLD}}"}, map[string][]string{
+		"Ubuntu-18.04": {"u18.dev.local", "{{if .Default}}default.{{.TLD}}{{end}}"},
+	})
+	assert.Nil(t, err)
+
+	names, err := n.Names(Distro{Name: "Debian"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"debian.wsl"}, names)
+
+	names, err = n.Names(Distro{Name: "Ubuntu-20.04"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ubuntu2004.wsl", "ubuntu-20-04.wsl"}, names)
+
+	names, err = n.Names(Distro{Name: "Ubuntu-18.04", Default: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"u18.dev.local", "default.wsl"}, names)
+
+	names, err = n.Names(Distro{Name: "Ubuntu-18.04"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"u18.dev.local"}, names)
+}
+
+func TestNamesEmptyTemplate(t *testing.T) {
+	n, err := New("wsl", []string{"{{if .Default}}default.{{.TLD}}{{end}}", DefaultTemplate, "{{if eq .Version 1}} {{end}}"}, nil)
+	assert.Nil(t, err)
+
+	names, err := n.Names(Distro{Name: "Debian", Version: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"debian.wsl"}, names)
+
+	names, err = n.Names(Distro{Name: "Debian", Version: 2, Default: true})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default.wsl", "debian.wsl"}, names)
+
+	n, err = New("wsl", []string{"{{if .Default}}default.{{.TLD}}{{end}}"}, nil)
+	assert.Nil(t, err)
+	names, err = n.Names(Distro{Name: "Debian"})
+	assert.Nil(t, err)
+	assert.Empty(t, names)
+}
+
+func TestNamesDetails(t *testing.T) {
+	n, err := New("wsl", []string{DefaultTemplate, "{{if .Hostname}}{{.Hostname | slug}}.{{.TLD}}{{end}}",
+		"{{if .User}}{{.User}}.{{.Name | compact}}.{{.TLD}}{{end}}"}, nil)
+	assert.Nil(t, err)
+	names, err := n.Names(Distro{Name: "Ubuntu-18.04", Hostname: "DESKTOP-1234", User: "shayne"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ubuntu1804.wsl", "desktop-1234.wsl", "shayne.ubuntu1804.wsl"}, names)
+
+	// stopped
+	names, err = n.Names(Distro{Name: "Ubuntu-18.04"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ubuntu1804.wsl"}, names)
+	_, err = n.Names(Distro{Name: "Ubuntu-18.04", User: "not_valid"})
+	assert.NotNil(t, err)
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New("wsl", []string{"{{.Name"}, nil)
+	assert.NotNil(t, err)
+	_, err = New("wsl", nil, nil)
+	assert.NotNil(t, err)
+	_, err = New("wsl", []string{DefaultTemplate}, map[string][]string{"Debian": {"{{nope .Name}}"}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,162 @@
+package naming
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Policy decides who gets a hostname claimed more than once
+type Policy string
+
+const (
+	// Error gives a contested hostname to none of its claimants
+	Error Policy = "error"
+	// FirstWins gives a contested hostname to its first claimant
+	FirstWins Policy = "first-wins"
+	// Suffix gives a contested hostname to its first claimant,
+	// the others getting it suffixed with their own name
+	Suffix Policy = "suffix"
+)
+
+// ParsePolicy returns the Policy named s
+func ParsePolicy(s string) (Policy, error) {
+	switch p := Policy(s); p {
+	case Error, FirstWins, Suffix:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown collision policy %q, expected %s, %s or %s", s, Error, FirstWins, Suffix)
+}
+
+// Claim is a set of hostnames wanted by someone
+type Claim struct {
+	// Owner describes the claimant, e.g. "distro Debian"
+	Owner string
+	// Suffix is slugged and appended to the first label of
+	// contested hostnames by the Suffix policy
+	Suffix string
+	Names  []string
+}
+
+// CollisionError reports a hostname claimed more than once
+// and how it was settled
+type CollisionError struct {
+	Hostname string
+	// Owners claiming the hostname, its holder first
+	Owners     []string
+	Resolution string
+}
+
+func (e *CollisionError) Error() string {
+	return fmt.Sprintf("hostname %s is claimed by %s: %s", e.Hostname, strings.Join(e.Owners, ", "), e.Resolution)
+}
+
+// suffixed inserts suffix after the first label of hostname,
+// "ubuntu.wsl" => "ubuntu-suffix.wsl"
+func suffixed(hostname, suffix string) string {
+	idx := strings.Index(hostname, ".")
+	if idx < 0 {
+		return hostname + "-" + suffix
+	}
+	return hostname[:idx] + "-" + suffix + hostname[idx:]
+}
+
+// Resolve hands out the claimed hostnames so that each goes to a
+// single claimant, returning the names of each claim in order
+// Reserved hostnames are held by someone else, described by the
+// map value, and never handed out
+func Resolve(claims []Claim, reserved map[string]string, policy Policy) ([][]string, []*CollisionError) {
+	owners := make(map[string][]int)
+	result := make([][]string, len(claims))
+	for idx, c := range claims {
+		seen := make(map[string]bool)
+		for _, name := range c.Names {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			owners[name] = append(owners[name], idx)
+			result[idx] = append(result[idx], name)
+		}
+	}
+
+	var contested []string
+	for name, o := range owners {
+		if _, taken := reserved[name]; taken || len(o) > 1 {
+			contested = append(contested, name)
+		}
+	}
+	sort.Strings(contested)
+
+	var errs []*CollisionError
+	for _, name := range contested {
+		o := owners[name]
+		e := &CollisionError{Hostname: name}
+		holder, taken := reserved[name]
+		if taken {
+			e.Owners = append(e.Owners, holder)
+		}
+		for _, idx := range o {
+			e.Owners = append(e.Owners, claims[idx].Owner)
+		}
+		losers := o
+		if !taken && policy != Error {
+			holder, losers = claims[o[0]].Owner, o[1:]
+		}
+
+		switch policy {
+		case Suffix:
+			var renames []string
+			for _, idx := range losers {
+				alt := suffixed(name, slug(claims[idx].Suffix))
+				_, altTaken := reserved[alt]
+				if altTaken || len(owners[alt]) > 0 || ValidHostname(alt) != nil {
+					result[idx] = remove(result[idx], name)
+					renames = append(renames, fmt.Sprintf("dropped for %s", claims[idx].Owner))
+					continue
+				}
+				owners[alt] = []int{idx}
+				result[idx] = replace(result[idx], name, alt)
+				renames = append(renames, fmt.Sprintf("%s for %s", alt, claims[idx].Owner))
+			}
+			e.Resolution = fmt.Sprintf("kept by %s, %s", holder, strings.Join(renames, ", "))
+		case FirstWins:
+			for _, idx := range losers {
+				result[idx] = remove(result[idx], name)
+			}
+			e.Resolution = fmt.Sprintf("kept by %s", holder)
+		default:
+			for _, idx := range losers {
+				result[idx] = remove(result[idx], name)
+			}
+			if taken {
+				e.Resolution = fmt.Sprintf("kept by %s", holder)
+			} else {
+				e.Resolution = "given to none"
+			}
+		}
+		errs = append(errs, e)
+	}
+	return result, errs
+}
+
+func remove(names []string, name string) []string {
+	var out []string
+	for _, n := range names {
+		if n != name {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func replace(names []string, name, with string) []string {
+	out := make([]string, len(names))
+	for idx, n := range names {
+		if n == name {
+			n = with
+		}
+		out[idx] = n
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+package naming
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testClaims() []Claim {
+	return []Claim{
+		{Owner: "Ubuntu-18.04", Suffix: "Ubuntu-18.04", Names: []string{"ubuntu1804.wsl"}},
+		{Owner: "Ubuntu-1804", Suffix: "Ubuntu-1804", Names: []string{"ubuntu1804.wsl", "u.wsl"}},
+		{Owner: "Debian", Suffix: "Debian", Names: []string{"debian.wsl"}},
+		{Owner: "alias of Ubuntu-18.04", Suffix: "Ubuntu-18.04", Names: []string{"app.local", "debian.wsl"}},
+	}
+}
+
+var testReserved = map[string]string{"app.local": "hosts file line 3"}
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range []Policy{Error, FirstWins, Suffix} {
+		parsed, err := ParsePolicy(string(p))
+		assert.Nil(t, err)
+		assert.Equal(t, p, parsed)
+	}
+	_, err := ParsePolicy("last-wins")
+	assert.NotNil(t, err)
+}
+
+func errorStrings(errs []*CollisionError) []string {
+	var out []string
+	for _, err := range errs {
+		out = append(out, err.Error())
+	}
+	return out
+}
+
+func TestResolveError(t *testing.T) {
+	names, errs := Resolve(testClaims(), testReserved, Error)
+	assert.Equal(t, [][]string{nil, {"u.wsl"}, nil, nil}, names)
+	assert.Equal(t, []string{
+		"hostname app.local is claimed by hosts file line 3, alias of Ubuntu-18.04: kept by hosts file line 3",
+		"hostname debian.wsl is claimed by Debian, alias of Ubuntu-18.04: given to none",
+		"hostname ubuntu1804.wsl is claimed by Ubuntu-18.04, Ubuntu-1804: given to none",
+	}, errorStrings(errs))
+}
+
+func TestResolveFirstWins(t *testing.T) {
+	names, errs := Resolve(testClaims(), testReserved, FirstWins)
+	assert.Equal(t, [][]string{{"ubuntu1804.wsl"}, {"u.wsl"}, {"debian.wsl"}, nil}, names)
+	assert.Equal(t, []string{
+		"hostname app.local is claimed by hosts file line 3, alias of Ubuntu-18.04: kept by hosts file line 3",
+		"hostname debian.wsl is claimed by Debian, alias of Ubuntu-18.04: kept by Debian",
+		"hostname ubuntu1804.wsl is claimed by Ubuntu-18.04, Ubuntu-1804: kept by Ubuntu-18.04",
+	}, errorStrings(errs))
+}
+
+func TestResolveSuffix(t *testing.T) {
+	names, errs := Resolve(testClaims(), testReserved, Suffix)
+	assert.Equal(t, [][]string{
+		{"ubuntu1804.wsl"},
+		{"ubuntu1804-ubuntu-1804.wsl", "u.wsl"},
+		{"debian.wsl"},
+		{"app-ubuntu-18-04.local", "debian-ubuntu-18-04.wsl"},
+	}, names)
+	assert.Equal(t, []string{
+		"hostname app.local is claimed by hosts file line 3, alias of Ubuntu-18.04: kept by hosts file line 3, app-ubuntu-18-04.local for alias of Ubuntu-18.04",
+		"hostname debian.wsl is claimed by Debian, alias of Ubuntu-18.04: kept by Debian, debian-ubuntu-18-04.wsl for alias of Ubuntu-18.04",
+		"hostname ubuntu1804.wsl is claimed by Ubuntu-18.04, Ubuntu-1804: kept by Ubuntu-18.04, ubuntu1804-ubuntu-1804.wsl for Ubuntu-1804",
+	}, errorStrings(errs))
+}
+
+func TestResolveSuffixTaken(t *testing.T) {
+	names, errs := Resolve([]Claim{
+		{Owner: "a", Suffix: "b", Names: []string{"x.wsl"}},
+		{Owner: "b", Suffix: "b", Names: []string{"x.wsl"}},
+		{Owner: "c", Suffix: "c", Names: []string{"x-b.wsl"}},
+	}, nil, Suffix)
+	assert.Equal(t, [][]string{{"x.wsl"}, nil, {"x-b.wsl"}}, names)
+	assert.Equal(t, []string{"hostname x.wsl is claimed by a, b: kept by a, dropped for b"}, errorStrings(errs))
+}
+
+func TestResolveNoCollisions(t *testing.T) {
+	names, errs := Resolve([]Claim{
+		{Owner: "a", Names: []string{"a.wsl", "a.wsl"}},
+		{Owner: "b", Names: []string{"b.wsl"}},
+	}, map[string]string{"localhost": "hosts file line 1"}, Error)
+	assert.Equal(t, [][]string{{"a.wsl"}, {"b.wsl"}}, names)
+	assert.Empty(t, errs)
+}
@@ -8,6 +8,8 @@ import (
 )
 
 const prefix = "alias:"
+const distroPrefix = "distro:"
+const hostPrefix = "host:"
 const defaultComment = "managed by wsl2-host"
 
 // IsAlias returns true if given string matches alias pattern
@@ -15,15 +17,27 @@ func IsAlias(comment string) bool {
 	return strings.HasPrefix(comment, prefix)
 }
 
+// IsHost returns true if given string matches the pattern
+// of the Windows host entry
+func IsHost(comment string) bool {
+	return strings.HasPrefix(comment, hostPrefix)
+}
+
 // DistroName returns the name of the WSL distro the host
-// entry is an alias for
+// entry is an alias for, or the distro's own entry
 func DistroName(comment string) (string, error) {
-	if !IsAlias(comment) {
+	var rest string
+	switch {
+	case IsAlias(comment):
+		rest = comment[len(prefix):]
+	case strings.HasPrefix(comment, distroPrefix):
+		rest = comment[len(distroPrefix):]
+	default:
 		return "", fmt.Errorf("comment is not alias: %s", comment)
 	}
 
 	var name string
-	for _, c := range comment[len(prefix):] {
+	for _, c := range rest {
 		if c == ';' {
 			break
 		}
@@ -40,6 +54,18 @@ func DistroComment(distroname string) string {
 	return fmt.Sprintf("%s %s; %s", prefix, distroname, defaultComment)
 }
 
+// PrimaryComment returns hosts file comment for the
+// entry named after the given distro
+func PrimaryComment(distroname string) string {
+	return fmt.Sprintf("%s %s; %s", distroPrefix, distroname, defaultComment)
+}
+
+// HostComment returns hosts file comment for the entry
+// of the Windows host with the given hostname
+func HostComment(hostname string) string {
+	return fmt.Sprintf("%s %s; %s", hostPrefix, hostname, defaultComment)
+}
+
 // DefaultComment returns basic comment for managed host entires
 func DefaultComment() string {
 	return defaultComment
@@ -8,9 +8,15 @@ import (
 
 func TestIsAlias(t *testing.T) {
 	assert.True(t, IsAlias("alias: Ubuntu-18.04; managed by wsl2-host"))
+	assert.False(t, IsAlias("distro: Ubuntu-18.04; managed by wsl2-host"))
 	assert.False(t, IsAlias("managed by wsl2-host"))
 }
 
+func TestIsHost(t *testing.T) {
+	assert.True(t, IsHost("host: DESKTOP-1234; managed by wsl2-host"))
+	assert.False(t, IsHost("alias: Ubuntu-18.04; managed by wsl2-host"))
+}
+
 func TestDistroName(t *testing.T) {
 	name, err := DistroName("alias: Ubuntu-18.04; managed by wsl2-host")
 	assert.Nil(t, err)
@@ -21,6 +27,12 @@ func TestDistroName(t *testing.T) {
 	name, err = DistroName("alias: Foo Bar; managed by wsl2-host")
 	assert.Nil(t, err)
 	assert.Equal(t, "Foo Bar", name)
+	name, err = DistroName("distro: Ubuntu-18.04; managed by wsl2-host")
+	assert.Nil(t, err)
+	assert.Equal(t, "Ubuntu-18.04", name)
+	name, err = DistroName("host: DESKTOP-1234; managed by wsl2-host")
+	assert.NotNil(t, err)
+	assert.Equal(t, "", name)
 	name, err = DistroName("managed by wsl2-host")
 	assert.NotNil(t, err)
 	assert.Equal(t, "", name)
@@ -31,6 +43,14 @@ func TestDistroComment(t *testing.T) {
 	assert.Equal(t, "alias: Ubuntu-18.04; managed by wsl2-host", comment)
 }
 
+func TestPrimaryComment(t *testing.T) {
+	assert.Equal(t, "distro: Ubuntu-18.04; managed by wsl2-host", PrimaryComment("Ubuntu-18.04"))
+}
+
+func TestHostComment(t *testing.T) {
+	assert.Equal(t, "host: DESKTOP-1234; managed by wsl2-host", HostComment("DESKTOP-1234"))
+}
+
 func TestDefaultComment(t *testing.T) {
 	assert.Equal(t, "managed by wsl2-host", DefaultComment())
 }
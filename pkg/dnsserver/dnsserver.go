@@ -0,0 +1,479 @@
+// Package dnsserver provides a small DNS responder answering
+// authoritatively for the distro hostnames of a zone
+package dnsserver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ttl of the answered records, kept short as distro
+// addresses change whenever WSL restarts
+const ttl = 10
+
+var forwardTimeout = 5 * time.Second
+
+const tcpTimeout = 10 * time.Second
+const maxUDPSize = 512
+
+// maxUDPQueries bounds the UDP queries handled at once, those
+// waiting on upstream included
+const maxUDPQueries = 64
+
+// Server answers A, AAAA, PTR and SOA queries for the records it
+// is given, forwarding or refusing everything else
+type Server struct {
+	zone     string // fully qualified, e.g. "wsl."
+	upstream string // "host:port" to forward to, refuse when empty
+
+	mu      sync.RWMutex
+	forward map[string][]net.IP
+	reverse map[string][]string
+	serial  uint32
+
+	udp net.PacketConn
+	tcp net.Listener
+	wg  sync.WaitGroup
+}
+
+// New creates a Server authoritative for zone, forwarding other
+// queries to upstream, or refusing them when upstream is empty
+func New(zone, upstream string) *Server {
+	return &Server{
+		zone:     fqdn(zone),
+		upstream: upstream,
+		forward:  make(map[string][]net.IP),
+		reverse:  make(map[string][]string),
+		serial:   1,
+	}
+}
+
+func fqdn(name string) string {
+	name = strings.ToLower(strings.Trim(name, "."))
+	return name + "."
+}
+
+// validName tells whether name, fully qualified, can be sent in
+// a message, hostnames coming from the aliases users write
+func validName(name string) bool {
+	if _, err := dnsmessage.NewName(name); err != nil {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
+
+// reverseName returns the in-addr.arpa or ip6.arpa name of ip
+func reverseName(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	const hexdigits = "0123456789abcdef"
+	var b strings.Builder
+	ip16 := ip.To16()
+	for i := len(ip16) - 1; i >= 0; i-- {
+		b.WriteByte(hexdigits[ip16[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hexdigits[ip16[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+// SetRecords replaces the served records, a map of hostnames to
+// their IPv4 and IPv6 addresses
+// PTR records are derived from them, in hostname order, unless
+// set with SetReverse
+// Hostnames that are not valid DNS names are left out
+func (s *Server) SetRecords(records map[string][]string) {
+	hostnames := make([]string, 0, len(records))
+	for hostname := range records {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	forward := make(map[string][]net.IP)
+	reverse := make(map[string][]string)
+	for _, hostname := range hostnames {
+		addrs := records[hostname]
+		name := fqdn(hostname)
+		if !validName(name) {
+			continue
+		}
+		for _, addr := range addrs {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				continue
+			}
+			forward[name] = append(forward[name], ip)
+			rname := reverseName(ip)
+			reverse[rname] = append(reverse[rname], name)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !sameRecords(s.forward, forward) {
+		s.serial++
+	}
+	s.forward = forward
+	s.reverse = reverse
+}
+
+// SetReverse replaces the PTR records with a map of IP
+// addresses to their hostnames, answered in the given order
+// Hostnames that are not valid DNS names are left out
+func (s *Server) SetReverse(reverse map[string][]string) {
+	r := make(map[string][]string)
+	for addr, hostnames := range reverse {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		rname := reverseName(ip)
+		for _, hostname := range hostnames {
+			if name := fqdn(hostname); validName(name) {
+				r[rname] = append(r[rname], name)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reverse = r
+}
+
+func sameRecords(a, b map[string][]net.IP) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, ips := range a {
+		other, ok := b[name]
+		if !ok || len(other) != len(ips) {
+			return false
+		}
+		for i := range ips {
+			if !ips[i].Equal(other[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Server) inZone(name string) bool {
+	return name == s.zone || strings.HasSuffix(name, "."+s.zone)
+}
+
+func (s *Server) soa() (dnsmessage.ResourceHeader, dnsmessage.SOAResource) {
+	zone := dnsmessage.MustNewName(s.zone)
+	return dnsmessage.ResourceHeader{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: ttl},
+		dnsmessage.SOAResource{
+			NS:      dnsmessage.MustNewName("ns." + s.zone),
+			MBox:    dnsmessage.MustNewName("hostmaster." + s.zone),
+			Serial:  s.serial,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  ttl,
+		}
+}
+
+// Handle answers a single DNS request message received over
+// UDP
+func (s *Server) Handle(req []byte) ([]byte, error) {
+	return s.handle(req, "udp")
+}
+
+// handle answers req, forwarding it upstream over network, the
+// one it was received over so truncated answers reach TCP clients
+// in full
+func (s *Server) handle(req []byte, network string) ([]byte, error) {
+	var msg dnsmessage.Message
+	err := msg.Unpack(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request: %w", err)
+	}
+	if msg.Header.Response {
+		return nil, errors.New("request is a response")
+	}
+	resp := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               msg.Header.ID,
+			Response:         true,
+			OpCode:           msg.Header.OpCode,
+			RecursionDesired: msg.Header.RecursionDesired,
+		},
+		Questions: msg.Questions,
+	}
+	if msg.Header.OpCode != 0 || len(msg.Questions) != 1 {
+		resp.Header.RCode = dnsmessage.RCodeNotImplemented
+		return resp.Pack()
+	}
+	q := msg.Questions[0]
+	name := strings.ToLower(q.Name.String())
+
+	s.mu.RLock()
+	answered := s.answer(&resp, q, name)
+	s.mu.RUnlock()
+	if answered {
+		return resp.Pack()
+	}
+
+	if s.upstream == "" {
+		resp.Header.RCode = dnsmessage.RCodeRefused
+		return resp.Pack()
+	}
+	out, err := s.forwardQuery(req, network)
+	if err != nil {
+		resp.Header.RCode = dnsmessage.RCodeServerFailure
+		return resp.Pack()
+	}
+	return out, nil
+}
+
+// answer fills resp for the names the server knows about, it
+// returns false for queries to hand upstream
+func (s *Server) answer(resp *dnsmessage.Message, q dnsmessage.Question, name string) bool {
+	if q.Class != dnsmessage.ClassINET && q.Class != dnsmessage.ClassANY {
+		return false
+	}
+	hdr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+
+	if q.Type == dnsmessage.TypePTR {
+		names, ok := s.reverse[name]
+		if !ok {
+			return false
+		}
+		resp.Header.Authoritative = true
+		hdr.Type = dnsmessage.TypePTR
+		for _, n := range names {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: hdr,
+				Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(n)},
+			})
+		}
+		return true
+	}
+
+	ips, known := s.forward[name]
+	if !known && !s.inZone(name) {
+		return false
+	}
+	resp.Header.Authoritative = s.inZone(name)
+	if q.Type == dnsmessage.TypeSOA && name == s.zone {
+		h, soa := s.soa()
+		resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: h, Body: &soa})
+		return true
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL) {
+			r := &dnsmessage.AResource{}
+			copy(r.A[:], ip4)
+			hdr.Type = dnsmessage.TypeA
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: r})
+		} else if ip.To4() == nil && (q.Type == dnsmessage.TypeAAAA || q.Type == dnsmessage.TypeALL) {
+			r := &dnsmessage.AAAAResource{}
+			copy(r.AAAA[:], ip.To16())
+			hdr.Type = dnsmessage.TypeAAAA
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: r})
+		}
+	}
+	if len(resp.Answers) == 0 && resp.Header.Authoritative {
+		if !known && name != s.zone {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+		h, soa := s.soa()
+		resp.Authorities = append(resp.Authorities, dnsmessage.Resource{Header: h, Body: &soa})
+	}
+	return true
+}
+
+func (s *Server) forwardQuery(req []byte, network string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, s.upstream, forwardTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(forwardTimeout))
+	if network == "tcp" {
+		err = writeTCP(conn, req)
+		if err != nil {
+			return nil, err
+		}
+		return readTCP(conn)
+	}
+	_, err = conn.Write(req)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// readTCP reads a message prefixed by its length as sent over TCP
+func readTCP(conn net.Conn) ([]byte, error) {
+	var size uint16
+	err := binary.Read(conn, binary.BigEndian, &size)
+	if err != nil {
+		return nil, err
+	}
+	msg := make([]byte, size)
+	_, err = io.ReadFull(conn, msg)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCP writes msg prefixed by its length
+func writeTCP(conn net.Conn, msg []byte) error {
+	out := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(out, uint16(len(msg)))
+	_, err := conn.Write(append(out, msg...))
+	return err
+}
+
+// Start listens for UDP and TCP queries on addr, both on the
+// same port when addr has port 0
+func (s *Server) Start(addr string) error {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return fmt.Errorf("failed to listen on tcp %s: %w", addr, err)
+	}
+	s.udp = udp
+	s.tcp = tcp
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// Close stops the listeners started with Start
+func (s *Server) Close() error {
+	if s.udp == nil {
+		return nil
+	}
+	err := s.udp.Close()
+	if terr := s.tcp.Close(); err == nil {
+		err = terr
+	}
+	s.wg.Wait()
+	return err
+}
+
+// serveUDP handles every datagram in its own goroutine, so a
+// query waiting on upstream does not hold up the others
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	buf := make([]byte, 65535)
+	busy := make(chan struct{}, maxUDPQueries)
+	for {
+		n, from, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case busy <- struct{}{}:
+		default:
+			// dropped, the client retrying
+			continue
+		}
+		// buf is reused by the next read
+		req := append([]byte(nil), buf[:n]...)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { <-busy }()
+			s.serveDatagram(req, from)
+		}()
+	}
+}
+
+func (s *Server) serveDatagram(req []byte, from net.Addr) {
+	resp, err := s.Handle(req)
+	if err != nil {
+		return
+	}
+	if len(resp) > maxUDPSize {
+		resp = truncate(resp)
+	}
+	s.udp.WriteTo(resp, from)
+}
+
+// truncate drops the records of a response too large for UDP,
+// setting TC so the client retries over TCP
+func truncate(resp []byte) []byte {
+	var msg dnsmessage.Message
+	if msg.Unpack(resp) != nil {
+		return resp
+	}
+	msg.Header.Truncated = true
+	msg.Answers, msg.Authorities, msg.Additionals = nil, nil, nil
+	out, err := msg.Pack()
+	if err != nil {
+		return resp
+	}
+	return out
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+		req, err := readTCP(conn)
+		if err != nil {
+			return
+		}
+		resp, err := s.handle(req, "tcp")
+		if err != nil {
+			return
+		}
+		err = writeTCP(conn, resp)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package dnsserver
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func query(t *testing.T, name string, qtype dnsmessage.Type) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  qtype,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	b, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func parse(t *testing.T, b []byte) dnsmessage.Message {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func testServer(upstream string) *Server {
+	s := New(".wsl", upstream)
+	s.SetRecords(map[string][]string{
+		"ubuntu1804.wsl": {"172.18.192.5", "2001:db8::5"},
+		"app.local":      {"172.18.192.5"},
+	})
+	return s
+}
+
+func TestHandle(t *testing.T) {
+	s := testServer("")
+
+	resp := parse(t, mustHandle(t, s, query(t, "Ubuntu1804.wsl.", dnsmessage.TypeA)))
+	assert.Equal(t, uint16(42), resp.Header.ID)
+	assert.True(t, resp.Header.Authoritative)
+	assert.Equal(t, dnsmessage.RCodeSuccess, resp.Header.RCode)
+	assert.Len(t, resp.Answers, 1)
+	assert.Equal(t, [4]byte{172, 18, 192, 5}, resp.Answers[0].Body.(*dnsmessage.AResource).A)
+
+	resp = parse(t, mustHandle(t, s, query(t, "ubuntu1804.wsl.", dnsmessage.TypeAAAA)))
+	assert.Len(t, resp.Answers, 1)
+	assert.Equal(t, net.ParseIP("2001:db8::5"), net.IP(resp.Answers[0].Body.(*dnsmessage.AAAAResource).AAAA[:]))
+
+	resp = parse(t, mustHandle(t, s, query(t, "missing.wsl.", dnsmessage.TypeA)))
+	assert.Equal(t, dnsmessage.RCodeNameError, resp.Header.RCode)
+	assert.Len(t, resp.Authorities, 1)
+
+	// known name without a record of the type
+	resp = parse(t, mustHandle(t, s, query(t, "app.local.", dnsmessage.TypeAAAA)))
+	assert.Equal(t, dnsmessage.RCodeSuccess, resp.Header.RCode)
+	assert.False(t, resp.Header.Authoritative)
+	assert.Empty(t, resp.Answers)
+
+	resp = parse(t, mustHandle(t, s, query(t, "wsl.", dnsmessage.TypeSOA)))
+	assert.Len(t, resp.Answers, 1)
+	assert.Equal(t, uint32(2), resp.Answers[0].Body.(*dnsmessage.SOAResource).Serial)
+
+	resp = parse(t, mustHandle(t, s, query(t, "5.192.18.172.in-addr.arpa.", dnsmessage.TypePTR)))
+	assert.True(t, resp.Header.Authoritative)
+	assert.Len(t, resp.Answers, 2)
+	assert.Equal(t, "app.local.", resp.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String())
+	resp = parse(t, mustHandle(t, s, query(t, "5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", dnsmessage.TypePTR)))
+	assert.Len(t, resp.Answers, 1)
+	assert.Equal(t, "ubuntu1804.wsl.", resp.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String())
+
+	resp = parse(t, mustHandle(t, s, query(t, "example.com.", dnsmessage.TypeA)))
+	assert.Equal(t, dnsmessage.RCodeRefused, resp.Header.RCode)
+
+	_, err := s.Handle([]byte{1, 2, 3})
+	assert.NotNil(t, err)
+}
+
+func mustHandle(t *testing.T, s *Server, req []byte) []byte {
+	t.Helper()
+	resp, err := s.Handle(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestSetReverse(t *testing.T) {
+	s := testServer("")
+	s.SetReverse(map[string][]string{"172.18.192.5": {"ubuntu1804.wsl", "app.local"}})
+	resp := parse(t, mustHandle(t, s, query(t, "5.192.18.172.in-addr.arpa.", dnsmessage.TypePTR)))
+	assert.Len(t, resp.Answers, 2)
+	assert.Equal(t, "ubuntu1804.wsl.", resp.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String())
+	assert.Equal(t, "app.local.", resp.Answers[1].Body.(*dnsmessage.PTRResource).PTR.String())
+
+	// IPv6 reverse entries come from SetReverse only now
+	resp = parse(t, mustHandle(t, s, query(t, "5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.", dnsmessage.TypePTR)))
+	assert.Equal(t, dnsmessage.RCodeRefused, resp.Header.RCode)
+}
+
+func TestSetInvalidNames(t *testing.T) {
+	long := strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." +
+		strings.Repeat("c", 63) + "." + strings.Repeat("d", 63) + ".wsl"
+	s := testServer("")
+	s.SetRecords(map[string][]string{
+		long:                             {"172.18.192.7"},
+		strings.Repeat("x", 64) + ".wsl": {"172.18.192.7"},
+		"two..dots.wsl":                  {"172.18.192.7"},
+		"debian.wsl":                     {"172.18.192.7"},
+	})
+	resp := parse(t, mustHandle(t, s, query(t, "7.192.18.172.in-addr.arpa.", dnsmessage.TypePTR)))
+	if assert.Len(t, resp.Answers, 1) {
+		assert.Equal(t, "debian.wsl.", resp.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String())
+	}
+
+	s.SetReverse(map[string][]string{"172.18.192.7": {long, "debian.wsl"}})
+	resp = parse(t, mustHandle(t, s, query(t, "7.192.18.172.in-addr.arpa.", dnsmessage.TypePTR)))
+	assert.Len(t, resp.Answers, 1)
+}
+
+func TestSetRecordsSerial(t *testing.T) {
+	s := testServer("")
+	assert.Equal(t, uint32(2), s.serial)
+	s.SetRecords(map[string][]string{
+		"app.local":      {"172.18.192.5"},
+		"ubuntu1804.wsl": {"172.18.192.5", "2001:db8::5"},
+	})
+	assert.Equal(t, uint32(2), s.serial)
+	s.SetRecords(map[string][]string{"app.local": {"172.18.192.6"}})
+	assert.Equal(t, uint32(3), s.serial)
+}
+
+func TestServeUDPAndTCP(t *testing.T) {
+	upstream := New(".example", "")
+	upstream.SetRecords(map[string][]string{"www.example": {"10.0.0.1"}})
+	assert.Nil(t, upstream.Start("127.0.0.1:0"))
+	defer upstream.Close()
+
+	s := testServer(upstream.Addr().String())
+	assert.Nil(t, s.Start("127.0.0.1:0"))
+	defer s.Close()
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+
+	_, err = conn.Write(query(t, "ubuntu1804.wsl.", dnsmessage.TypeA))
+	assert.Nil(t, err)
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	assert.Len(t, parse(t, buf[:n]).Answers, 1)
+
+	// forwarded
+	_, err = conn.Write(query(t, "www.example.", dnsmessage.TypeA))
+	assert.Nil(t, err)
+	n, err = conn.Read(buf)
+	assert.Nil(t, err)
+	resp := parse(t, buf[:n])
+	assert.Len(t, resp.Answers, 1)
+	assert.Equal(t, [4]byte{10, 0, 0, 1}, resp.Answers[0].Body.(*dnsmessage.AResource).A)
+
+	tconn, err := net.Dial("tcp", s.Addr().String())
+	assert.Nil(t, err)
+	defer tconn.Close()
+	tconn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := query(t, "ubuntu1804.wsl.", dnsmessage.TypeAAAA)
+	_, err = tconn.Write(append([]byte{byte(len(req) >> 8), byte(len(req))}, req...))
+	assert.Nil(t, err)
+	var size uint16
+	assert.Nil(t, binary.Read(tconn, binary.BigEndian, &size))
+	out := make([]byte, size)
+	_, err = io.ReadFull(tconn, out)
+	assert.Nil(t, err)
+	assert.Len(t, parse(t, out).Answers, 1)
+}
+
+func TestServeUDPBlackholedUpstream(t *testing.T) {
+	defer func(timeout time.Duration) { forwardTimeout = timeout }(forwardTimeout)
+	forwardTimeout = 2 * time.Second
+
+	// reads nothing and never answers
+	upstream, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+
+	s := testServer(upstream.LocalAddr().String())
+	assert.Nil(t, s.Start("127.0.0.1:0"))
+	defer s.Close()
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, err = conn.Write(query(t, "www.example.", dnsmessage.TypeA))
+	assert.Nil(t, err)
+	_, err = conn.Write(query(t, "ubuntu1804.wsl.", dnsmessage.TypeA))
+	assert.Nil(t, err)
+
+	// answered while the forwarded query waits
+	conn.SetDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if assert.Nil(t, err) {
+		resp := parse(t, buf[:n])
+		assert.True(t, resp.Header.Authoritative)
+		assert.Len(t, resp.Answers, 1)
+	}
+}
+
+func TestForwardTCP(t *testing.T) {
+	var ips []string
+	for i := 1; i <= 40; i++ {
+		ips = append(ips, fmt.Sprintf("10.0.0.%d", i))
+	}
+	upstream := New(".example", "")
+	upstream.SetRecords(map[string][]string{"big.example": ips})
+	assert.Nil(t, upstream.Start("127.0.0.1:0"))
+	defer upstream.Close()
+
+	s := testServer(upstream.Addr().String())
+	assert.Nil(t, s.Start("127.0.0.1:0"))
+	defer s.Close()
+
+	// too large for UDP
+	conn, err := net.Dial("udp", s.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Write(query(t, "big.example.", dnsmessage.TypeA))
+	assert.Nil(t, err)
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	assert.Nil(t, err)
+	resp := parse(t, buf[:n])
+	assert.True(t, resp.Header.Truncated)
+	assert.Empty(t, resp.Answers)
+
+	// the retry over TCP is forwarded over TCP
+	tconn, err := net.Dial("tcp", s.Addr().String())
+	assert.Nil(t, err)
+	defer tconn.Close()
+	tconn.SetDeadline(time.Now().Add(5 * time.Second))
+	assert.Nil(t, writeTCP(tconn, query(t, "big.example.", dnsmessage.TypeA)))
+	out, err := readTCP(tconn)
+	assert.Nil(t, err)
+	resp = parse(t, out)
+	assert.False(t, resp.Header.Truncated)
+	assert.Len(t, resp.Answers, 40)
+}
@@ -0,0 +1,134 @@
+package hostsapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxBackups is the number of hosts file backups kept
+// unless changed with SetMaxBackups
+const DefaultMaxBackups = 5
+
+const backupInfix = ".wsl2host-"
+const backupSuffix = ".bak"
+const backupTimeFormat = "20060102-150405.000000"
+
+// SetMaxBackups sets how many rotating backups Write keeps,
+// 0 disables backups
+func (h *HostsAPI) SetMaxBackups(n int) {
+	h.maxbackups = n
+}
+
+// Backups returns the paths of the existing hosts file backups,
+// newest first
+func (h *HostsAPI) Backups() ([]string, error) {
+	pattern := filepath.Join(filepath.Dir(h.path), filepath.Base(h.path)+backupInfix+"*"+backupSuffix)
+	backups, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	// timestamps sort lexically
+	sort.Sort(sort.Reverse(sort.StringSlice(backups)))
+	return backups, nil
+}
+
+// Restore replaces the hosts file with the given backup, which
+// is either a path returned by Backups or its base name
+// The replaced content is itself backed up
+func (h *HostsAPI) Restore(backup string) error {
+	if !strings.ContainsAny(backup, `/\`) {
+		backup = filepath.Join(filepath.Dir(h.path), backup)
+	}
+	content, err := ioutil.ReadFile(backup)
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	err = h.replace(content)
+	if err != nil {
+		return err
+	}
+	return h.loadAndParse(content)
+}
+
+// replace atomically swaps the hosts file content, backing
+// up the previous content first
+func (h *HostsAPI) replace(content []byte) error {
+	dir := filepath.Dir(h.path)
+	var mode os.FileMode = 0644
+	if fi, err := os.Stat(h.path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(h.path)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create temp hosts file: %w", err)
+	}
+	tmpname := tmp.Name()
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tmpname)
+		}
+	}()
+
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temp hosts file: %w", err)
+	}
+	err = os.Chmod(tmpname, mode)
+	if err != nil {
+		return fmt.Errorf("failed to set temp hosts file mode: %w", err)
+	}
+
+	err = h.backup()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpname, h.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace hosts file: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+// backup saves the current content of the hosts file, which may
+// have been edited since it was loaded, and prunes the oldest
+// backups
+func (h *HostsAPI) backup() error {
+	if h.maxbackups <= 0 {
+		return nil
+	}
+	content, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read hosts file to back up: %w", err)
+	}
+	name := h.path + backupInfix + h.now().Format(backupTimeFormat) + backupSuffix
+	err = ioutil.WriteFile(name, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to back up hosts file: %w", err)
+	}
+
+	backups, err := h.Backups()
+	if err != nil {
+		return err
+	}
+	for i := h.maxbackups; i < len(backups); i++ {
+		os.Remove(backups[i])
+	}
+	return nil
+}
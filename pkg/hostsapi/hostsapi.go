@@ -5,126 +5,219 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"os"
+	"io/ioutil"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
-const hostspath = "C:/Windows/System32/drivers/etc/hosts"
+// DefaultPath is the location of the Windows hosts file
+const DefaultPath = "C:/Windows/System32/drivers/etc/hosts"
 
 // HostEntry data structure for IP and hostnames
+// An entry with both IP and IPv6 set is written as two lines
 type HostEntry struct {
-	idx      int
+	line     *hostsLine // IPv4 line the entry was parsed from
+	line6    *hostsLine // IPv6 line the entry was parsed from
 	IP       string
+	IPv6     string
 	Hostname string
 	Comment  string
 }
 
+// address is one of the addresses of an entry, each
+// written on its own line
+type address struct {
+	e  *HostEntry
+	v6 bool
+}
+
+func (a address) ip() string {
+	if a.v6 {
+		return a.e.IPv6
+	}
+	return a.e.IP
+}
+
+func (a address) line() *hostsLine {
+	if a.v6 {
+		return a.e.line6
+	}
+	return a.e.line
+}
+
+func isIPv6(ip string) bool {
+	return strings.Contains(ip, ":")
+}
+
 // HostsAPI data structure
+// When a filter is given the managed entries are kept in a block
+// delimited by "# BEGIN <filter>" and "# END <filter>" lines whose
+// content is entirely owned by the API
 type HostsAPI struct {
-	filter    string
-	hostsfile *os.File
-	entries   map[string]*HostEntry
-	remidxs   map[int]interface{}
+	path       string
+	filter     string
+	content    []byte
+	lines      []string
+	entries    map[string]*HostEntry
+	remidxs    map[int]interface{}
+	dups       map[int]map[string]bool // hostnames left on their line, by line
+	blockidx   int                     // line of the block's begin marker, -1 when absent
+	groupfn    func(*HostEntry) string
+	preserve   bool
+	maxbackups int
+	now        func() time.Time
 }
 
+const blockBegin = "# BEGIN "
+const blockEnd = "# END "
+
 func parseHostfileLine(idx int, line string) ([]*HostEntry, error) {
-	if len(line) <= 0 {
-		return nil, errors.New("invalid line")
-	}
-	line = strings.TrimSpace(line)
-	if line[0] == '#' {
-		return nil, errors.New("comment line")
+	l, err := parseLine(idx, line)
+	if err != nil {
+		return nil, err
 	}
-	fields := strings.Fields(line)
-	var ip string
-	var hostnames []string
-	var comment string
-	var commentidx int
-	for i, f := range fields {
-		if f == "" {
-			continue
-		}
-		if f[0] == '#' { // inline comment
-			commentidx = i + 1
-			break // don't process any more
+	comment := l.commentText()
+	var entries []*HostEntry
+	for _, hostname := range l.hostnames {
+		e := &HostEntry{
+			Hostname: hostname,
+			Comment:  comment,
 		}
-		if i == 0 {
-			ip = f
+		if isIPv6(l.ip) {
+			e.line6 = l
+			e.IPv6 = l.ip
 		} else {
-			hostnames = append(hostnames, f)
+			e.line = l
+			e.IP = l.ip
 		}
+		entries = append(entries, e)
 	}
-	if commentidx > 0 {
-		comment = strings.Join(fields[commentidx:], " ")
+
+	return entries, nil
+}
+
+func (h *HostsAPI) isMarker(line string) bool {
+	line = strings.TrimSpace(line)
+	return h.filter != "" && (line == blockBegin+h.filter || line == blockEnd+h.filter)
+}
+
+// findBlock returns the lines of the begin and end markers of
+// the managed block, or -1 when there is no complete block
+func (h *HostsAPI) findBlock() (int, int) {
+	if h.filter == "" {
+		return -1, -1
 	}
-	if ip == "" || len(hostnames) == 0 {
-		return nil, fmt.Errorf("invalid fields for line: %q", line)
+	begin, end := -1, -1
+	for idx, line := range h.lines {
+		line = strings.TrimSpace(line)
+		if begin < 0 && line == blockBegin+h.filter {
+			begin = idx
+		} else if begin >= 0 && line == blockEnd+h.filter {
+			end = idx
+			break
+		}
 	}
-	var entries []*HostEntry
-	for _, hostname := range hostnames {
-		entries = append(entries, &HostEntry{
-			idx:      idx,
-			IP:       ip,
-			Hostname: hostname,
-			Comment:  comment,
-		})
+	if end < 0 {
+		return -1, -1
 	}
-
-	return entries, nil
+	return begin, end
 }
 
-func (h *HostsAPI) loadAndParse() error {
-	scanner := bufio.NewScanner(h.hostsfile)
-	idx := 0
+func (h *HostsAPI) loadAndParse(content []byte) error {
+	h.content = content
+	h.lines = nil
+	h.entries = make(map[string]*HostEntry)
+	h.remidxs = make(map[int]interface{})
+	h.dups = make(map[int]map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
 	for scanner.Scan() {
-		line := scanner.Text()
+		h.lines = append(h.lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	begin, end := h.findBlock()
+	h.blockidx = begin
+	for idx, line := range h.lines {
+		inblock := begin >= 0 && idx >= begin && idx <= end
+		if inblock || h.isMarker(line) {
+			// the block is regenerated on write, stray markers dropped
+			h.remidxs[idx] = nil
+		}
 		entries, err := parseHostfileLine(idx, line)
-		idx++
 		if err != nil {
 			// log.Println(err) // debug
 			continue
 		}
 		for _, e := range entries {
-			if h.filter == "" || strings.Contains(e.Comment, h.filter) {
-				h.entries[e.Hostname] = e
-				h.remidxs[e.idx] = nil
+			// entries tagged outside the block are legacy ones,
+			// migrated into the block on write
+			if !inblock && h.filter != "" && !strings.Contains(e.Comment, h.filter) {
+				continue
 			}
+			if e.line != nil {
+				e.line.inblock = inblock
+			} else {
+				e.line6.inblock = inblock
+			}
+			// merge the IPv4 and IPv6 lines of a hostname
+			if prev, exists := h.entries[e.Hostname]; exists {
+				if e.line != nil && prev.line == nil {
+					h.remidxs[idx] = nil
+					prev.line, prev.IP = e.line, e.IP
+					continue
+				}
+				if e.line6 != nil && prev.line6 == nil {
+					h.remidxs[idx] = nil
+					prev.line6, prev.IPv6 = e.line6, e.IPv6
+					continue
+				}
+				if h.filter == "" {
+					// the first line of a hostname wins as for
+					// resolvers, later ones are left as written
+					if h.dups[idx] == nil {
+						h.dups[idx] = make(map[string]bool)
+					}
+					h.dups[idx][e.Hostname] = true
+					continue
+				}
+			}
+			h.remidxs[idx] = nil
+			h.entries[e.Hostname] = e
 		}
 	}
-	h.hostsfile.Seek(0, 0)
 	return nil
 }
 
 // CreateAPI creates a new instance of the hosts file API
+// for the hosts file at `path`, usually DefaultPath
 // Call Close() when finished
 // `filter` proves ability to filter by string contains
-func CreateAPI(filter string) (*HostsAPI, error) {
-	f, err := os.Open(hostspath)
+func CreateAPI(path, filter string) (*HostsAPI, error) {
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open hosts file: %w", err)
 	}
 	h := &HostsAPI{
-		filter:    filter,
-		remidxs:   make(map[int]interface{}),
-		entries:   make(map[string]*HostEntry),
-		hostsfile: f,
+		path:       path,
+		filter:     filter,
+		maxbackups: DefaultMaxBackups,
+		now:        time.Now,
 	}
-	err = h.loadAndParse()
+	err = h.loadAndParse(content)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse hosts file: %w", err)
 	}
 	return h, nil
 }
 
-// Close closes the hosts file
+// Close releases the API, the hosts file itself is only
+// held open while reading and writing
 func (h *HostsAPI) Close() error {
-	err := h.hostsfile.Close()
-	if err != nil {
-		return fmt.Errorf("failed to close hosts file: %w", err)
-	}
-
 	return nil
 }
 
@@ -133,6 +226,41 @@ func (h *HostsAPI) Entries() map[string]*HostEntry {
 	return h.entries
 }
 
+// Unmanaged returns the entries of the lines left alone by the
+// API, in file order, including the later lines of a hostname
+// listed several times when not filtering
+func (h *HostsAPI) Unmanaged() []*HostEntry {
+	var entries []*HostEntry
+	for idx, line := range h.lines {
+		_, managed := h.remidxs[idx]
+		if managed && h.dups[idx] == nil {
+			continue
+		}
+		parsed, err := parseHostfileLine(idx, line)
+		if err != nil {
+			continue
+		}
+		for _, e := range parsed {
+			if !managed || h.dups[idx][e.Hostname] {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries
+}
+
+// LineNumber returns the line of the hosts file the entry
+// was read from, starting at 1, or 0 for added entries
+func (e *HostEntry) LineNumber() int {
+	switch {
+	case e.line != nil:
+		return e.line.idx + 1
+	case e.line6 != nil:
+		return e.line6.idx + 1
+	}
+	return 0
+}
+
 // RemoveEntry removes existing entry from hosts file
 func (h *HostsAPI) RemoveEntry(hostname string) error {
 	if _, exists := h.entries[hostname]; exists {
@@ -154,42 +282,212 @@ func (h *HostsAPI) AddEntry(entry *HostEntry) error {
 	return nil
 }
 
-// Write
+// SetGroupFunc sets the function used to group entries when
+// writing, entries are ordered by group then hostname
+func (h *HostsAPI) SetGroupFunc(fn func(*HostEntry) string) {
+	h.groupfn = fn
+}
+
+// SetPreserveOrder makes Write keep entries read from the file
+// at their original position, only added entries are sorted
+// Single hostname entries outside the block are then not
+// migrated into it
+func (h *HostsAPI) SetPreserveOrder(preserve bool) {
+	h.preserve = preserve
+}
+
+// Path returns the location of the managed hosts file
+func (h *HostsAPI) Path() string {
+	return h.path
+}
+
+// Write saves the entries back to the hosts file
+// The new content is staged next to the hosts file and renamed
+// over it, so the hosts file is never left partially written
 func (h *HostsAPI) Write() error {
+	content := h.Render()
+	err := h.replace(content)
+	if err != nil {
+		return err
+	}
+
+	return h.loadAndParse(content)
+}
+
+// Content returns the hosts file as it was read or last written
+func (h *HostsAPI) Content() []byte {
+	return h.content
+}
+
+// Render returns the content Write would save, without
+// touching the hosts file
+func (h *HostsAPI) Render() []byte {
 	var outbuf bytes.Buffer
 
-	// first remove all current entries
-	scanner := bufio.NewScanner(h.hostsfile)
-	for idx := 0; scanner.Scan() == true; idx++ {
-		line := scanner.Text()
+	inplace := make(map[int][]address)
+	var blockaddrs []address
+	for _, e := range h.entries {
+		for _, a := range []address{{e, false}, {e, true}} {
+			if a.ip() == "" {
+				continue
+			}
+			if h.editInPlace(a) {
+				idx := a.line().idx
+				inplace[idx] = append(inplace[idx], a)
+			} else {
+				blockaddrs = append(blockaddrs, a)
+			}
+		}
+	}
+	edited := make(map[int]string)
+	for idx, addrs := range inplace {
+		var detached []address
+		edited[idx], detached = editLine(addrs, h.dups[idx])
+		blockaddrs = append(blockaddrs, detached...)
+	}
+	for idx, dups := range h.dups {
+		if _, ok := edited[idx]; ok {
+			continue
+		}
+		if l, err := parseLine(idx, h.lines[idx]); err == nil {
+			edited[idx] = l.render(l.ip, dups, l.commentText())
+		}
+	}
+
+	// first remove all current entries, the block is
+	// rewritten in place if it already exists
+	written := false
+	for idx, line := range h.lines {
+		if idx == h.blockidx {
+			h.writeEntries(&outbuf, blockaddrs)
+			written = true
+		}
 		if _, exists := h.remidxs[idx]; !exists {
 			outbuf.WriteString(line)
 			outbuf.WriteString("\r\n")
+		} else if line, ok := edited[idx]; ok {
+			outbuf.WriteString(line)
+			outbuf.WriteString("\r\n")
 		}
 	}
 
 	// append entries to file
-	for _, e := range h.entries {
-		var comment string
-		if e.Comment != "" {
-			comment = fmt.Sprintf("    # %s", e.Comment)
+	if !written {
+		h.writeEntries(&outbuf, blockaddrs)
+	}
+
+	return outbuf.Bytes()
+}
+
+// editInPlace returns whether a loaded address is written back
+// on its original line instead of the block
+// Lines listing several hostnames are user authored, only
+// single hostname lines are legacy entries to migrate
+func (h *HostsAPI) editInPlace(a address) bool {
+	l := a.line()
+	if l == nil || l.inblock {
+		return false
+	}
+	return h.filter == "" || h.preserve || len(l.hostnames) > 1
+}
+
+// editLine renders the line the given addresses were parsed from
+// with only their hostnames and dups left on it
+// The line keeps the IP and comment shared by its addresses, those
+// that no longer agree with it are returned to be written apart
+// The dups stay with the original IP and comment, the addresses
+// all being written apart when these changed
+func editLine(addrs []address, dups map[string]bool) (string, []address) {
+	l := addrs[0].line()
+	order := make(map[string]int)
+	for i, hostname := range l.hostnames {
+		order[hostname] = i
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return order[addrs[i].e.Hostname] < order[addrs[j].e.Hostname]
+	})
+
+	// prefer keeping addresses unchanged since loading on the line
+	ref := addrs[0]
+	for _, a := range addrs {
+		if a.ip() == l.ip && a.e.Comment == l.commentText() {
+			ref = a
+			break
 		}
-		outbuf.WriteString(fmt.Sprintf("%s %s%s\r\n", e.IP, e.Hostname, comment))
 	}
+	if len(dups) > 0 && (ref.ip() != l.ip || ref.e.Comment != l.commentText()) {
+		return l.render(l.ip, dups, l.commentText()), addrs
+	}
+	keep := make(map[string]bool)
+	for hostname := range dups {
+		keep[hostname] = true
+	}
+	var detached []address
+	for _, a := range addrs {
+		if a.ip() == ref.ip() && a.e.Comment == ref.e.Comment {
+			keep[a.e.Hostname] = true
+		} else {
+			detached = append(detached, a)
+		}
+	}
+	return l.render(ref.ip(), keep, ref.e.Comment), detached
+}
 
-	f, err := os.OpenFile(hostspath, os.O_WRONLY|os.O_TRUNC, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to open hosts file for writing: %w", err)
+// sortAddresses orders addresses by group, hostname then family,
+// after the addresses read from the file when preserving their order
+func (h *HostsAPI) sortAddresses(addrs []address) {
+	group := func(e *HostEntry) string {
+		if h.groupfn == nil {
+			return ""
+		}
+		return h.groupfn(e)
 	}
-	defer f.Close()
+	sort.Slice(addrs, func(i, j int) bool {
+		a, b := addrs[i], addrs[j]
+		if h.preserve {
+			la, lb := a.line(), b.line()
+			if (la != nil) != (lb != nil) {
+				return la != nil
+			}
+			if la != nil && la.idx != lb.idx {
+				return la.idx < lb.idx
+			}
+		}
+		if ga, gb := group(a.e), group(b.e); ga != gb {
+			return ga < gb
+		}
+		if a.e.Hostname != b.e.Hostname {
+			return a.e.Hostname < b.e.Hostname
+		}
+		return !a.v6 && b.v6
+	})
+}
 
-	f.Write(outbuf.Bytes())
-	err = f.Sync()
-	if err != nil {
-		return err
+func writeAddress(outbuf *bytes.Buffer, a address) {
+	var comment string
+	if a.e.Comment != "" {
+		comment = fmt.Sprintf("    # %s", a.e.Comment)
 	}
+	outbuf.WriteString(fmt.Sprintf("%s %s%s\r\n", a.ip(), a.e.Hostname, comment))
+}
 
-	return nil
+// writeEntries writes the given addresses in order, inside
+// the block markers when filtering
+func (h *HostsAPI) writeEntries(outbuf *bytes.Buffer, addrs []address) {
+	if len(addrs) == 0 {
+		return
+	}
+	h.sortAddresses(addrs)
+
+	if h.filter != "" {
+		outbuf.WriteString(blockBegin + h.filter + "\r\n")
+	}
+	for _, a := range addrs {
+		writeAddress(outbuf, a)
+	}
+	if h.filter != "" {
+		outbuf.WriteString(blockEnd + h.filter + "\r\n")
+	}
 }
 
 // GetHostIP returns the IP address of Hyper-V Switch on the host connected to WSL
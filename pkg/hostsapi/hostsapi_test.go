@@ -0,0 +1,394 @@
+package hostsapi
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempHosts(t *testing.T, content string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "hostsapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readHosts(t *testing.T, path string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCreateAPIFilter(t *testing.T) {
+	path := tempHosts(t, "# comment\r\n"+
+		"127.0.0.1 localhost\r\n"+
+		"172.18.192.5 ubuntu1804.wsl    # managed by wsl2-host\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+	assert.Equal(t, path, h.Path())
+	assert.Len(t, h.Entries(), 1)
+	assert.Equal(t, "172.18.192.5", h.Entries()["ubuntu1804.wsl"].IP)
+
+	all, err := CreateAPI(path, "")
+	assert.Nil(t, err)
+	defer all.Close()
+	assert.Len(t, all.Entries(), 2)
+
+	_, err = CreateAPI(filepath.Join(filepath.Dir(path), "missing"), "")
+	assert.NotNil(t, err)
+}
+
+func TestUnmanaged(t *testing.T) {
+	path := tempHosts(t, "# comment\r\n"+
+		"127.0.0.1 localhost\r\n"+
+		"10.0.0.1 app.local db.local # mine\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804.wsl    # distro: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n"+
+		"172.18.192.6 debian.wsl    # managed by wsl2-host\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+
+	var got []string
+	for _, e := range h.Unmanaged() {
+		got = append(got, fmt.Sprintf("%d %s %s", e.LineNumber(), e.IP, e.Hostname))
+	}
+	assert.Equal(t, []string{
+		"2 127.0.0.1 localhost",
+		"3 10.0.0.1 app.local",
+		"3 10.0.0.1 db.local",
+	}, got)
+	assert.Equal(t, 5, h.Entries()["ubuntu1804.wsl"].LineNumber())
+}
+
+func TestWrite(t *testing.T) {
+	path := tempHosts(t, "127.0.0.1 localhost\r\n"+
+		"172.18.192.5 ubuntu1804.wsl    # managed by wsl2-host\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+
+	assert.Nil(t, h.RemoveEntry("ubuntu1804.wsl"))
+	assert.NotNil(t, h.RemoveEntry("ubuntu1804.wsl"))
+	assert.Nil(t, h.AddEntry(&HostEntry{IP: "172.18.192.6", Hostname: "debian.wsl", Comment: "managed by wsl2-host"}))
+	assert.NotNil(t, h.AddEntry(&HostEntry{IP: "172.18.192.7", Hostname: "debian.wsl"}))
+
+	want := "127.0.0.1 localhost\r\n" +
+		"# BEGIN wsl2-host\r\n" +
+		"172.18.192.6 debian.wsl    # managed by wsl2-host\r\n" +
+		"# END wsl2-host\r\n"
+	// rendering leaves the file alone
+	before := readHosts(t, path)
+	assert.Equal(t, want, string(h.Render()))
+	assert.Equal(t, before, string(h.Content()))
+	assert.Equal(t, before, readHosts(t, path))
+
+	assert.Nil(t, h.Write())
+	assert.Equal(t, want, readHosts(t, path))
+	assert.Equal(t, want, string(h.Content()))
+}
+
+func TestWriteBlock(t *testing.T) {
+	path := tempHosts(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"# stray comment dropped on write\r\n"+
+		"172.18.192.5 ubuntu1804.wsl\r\n"+
+		"# END wsl2-host\r\n"+
+		"10.0.0.1 nas.local\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+	assert.Len(t, h.Entries(), 1)
+
+	assert.Nil(t, h.AddEntry(&HostEntry{IP: "172.18.192.6", Hostname: "alpine.wsl"}))
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.6 alpine.wsl\r\n"+
+		"172.18.192.5 ubuntu1804.wsl\r\n"+
+		"# END wsl2-host\r\n"+
+		"10.0.0.1 nas.local\r\n", readHosts(t, path))
+
+	assert.Nil(t, h.RemoveEntry("alpine.wsl"))
+	assert.Nil(t, h.RemoveEntry("ubuntu1804.wsl"))
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"10.0.0.1 nas.local\r\n", readHosts(t, path))
+}
+
+func TestWriteMigratesLegacyEntries(t *testing.T) {
+	path := tempHosts(t, "127.0.0.1 localhost\r\n"+
+		"172.18.192.5 ubuntu1804.wsl    # managed by wsl2-host\r\n"+
+		"10.0.0.1 nas.local\r\n"+
+		"172.18.192.5 app.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"# BEGIN wsl2-host\r\n") // unterminated, dropped
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+	assert.Len(t, h.Entries(), 2)
+
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"10.0.0.1 nas.local\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.5 app.local    # alias: Ubuntu-18.04; managed by wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804.wsl    # managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n", readHosts(t, path))
+}
+
+func groupByComment(e *HostEntry) string {
+	return e.Comment
+}
+
+func TestWriteGroupedOrder(t *testing.T) {
+	path := tempHosts(t, "127.0.0.1 localhost\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+	h.SetGroupFunc(groupByComment)
+
+	for _, e := range []*HostEntry{
+		{IP: "172.18.192.6", Hostname: "z.local", Comment: "b"},
+		{IP: "172.18.192.5", Hostname: "y.local", Comment: "a"},
+		{IP: "172.18.192.6", Hostname: "debian.wsl", Comment: "b"},
+		{IP: "172.18.192.5", Hostname: "ubuntu.wsl", Comment: "a"},
+	} {
+		assert.Nil(t, h.AddEntry(e))
+	}
+	assert.Nil(t, h.Write())
+	expected := "127.0.0.1 localhost\r\n" +
+		"# BEGIN wsl2-host\r\n" +
+		"172.18.192.5 ubuntu.wsl    # a\r\n" +
+		"172.18.192.5 y.local    # a\r\n" +
+		"172.18.192.6 debian.wsl    # b\r\n" +
+		"172.18.192.6 z.local    # b\r\n" +
+		"# END wsl2-host\r\n"
+	assert.Equal(t, expected, readHosts(t, path))
+
+	// rewriting unchanged entries is stable
+	assert.Nil(t, h.Write())
+	assert.Equal(t, expected, readHosts(t, path))
+}
+
+func TestWritePreserveOrder(t *testing.T) {
+	path := tempHosts(t, "172.18.192.9 legacy.wsl    # managed by wsl2-host\r\n"+
+		"127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.6 z.local\r\n"+
+		"172.18.192.5 a.local\r\n"+
+		"# END wsl2-host\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+	h.SetPreserveOrder(true)
+
+	h.Entries()["a.local"].IP = "172.18.192.7"
+	h.Entries()["legacy.wsl"].IP = "172.18.192.8"
+	assert.Nil(t, h.AddEntry(&HostEntry{IP: "172.18.192.7", Hostname: "m.local"}))
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "172.18.192.8 legacy.wsl    # managed by wsl2-host\r\n"+
+		"127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.6 z.local\r\n"+
+		"172.18.192.7 a.local\r\n"+
+		"172.18.192.7 m.local\r\n"+
+		"# END wsl2-host\r\n", readHosts(t, path))
+}
+
+func TestWriteEditsMultiHostnameLines(t *testing.T) {
+	path := tempHosts(t, "# user file\r\n"+
+		"  10.0.0.1\tnas  nas.local media   # home server\r\n"+
+		"10.0.0.2 printer scanner\r\n"+
+		"10.0.0.3 router gateway\r\n")
+	h, err := CreateAPI(path, "")
+	assert.Nil(t, err)
+	defer h.Close()
+	assert.Len(t, h.Entries(), 7)
+
+	assert.Nil(t, h.RemoveEntry("nas.local"))
+	h.Entries()["scanner"].IP = "10.0.0.9"
+	h.Entries()["router"].IP = "10.0.0.4"
+	h.Entries()["gateway"].IP = "10.0.0.4"
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "# user file\r\n"+
+		"  10.0.0.1\tnas media   # home server\r\n"+
+		"10.0.0.2 printer\r\n"+
+		"10.0.0.4 router gateway\r\n"+
+		"10.0.0.9 scanner\r\n", readHosts(t, path))
+
+	assert.Nil(t, h.RemoveEntry("nas"))
+	assert.Nil(t, h.RemoveEntry("media"))
+	h.Entries()["printer"].Comment = "office"
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "# user file\r\n"+
+		"10.0.0.2 printer    # office\r\n"+
+		"10.0.0.4 router gateway\r\n"+
+		"10.0.0.9 scanner\r\n", readHosts(t, path))
+}
+
+func TestWriteKeepsTaggedMultiHostnameLines(t *testing.T) {
+	path := tempHosts(t, "127.0.0.1 localhost\r\n"+
+		"172.18.192.5\tapp.local\tapi.local\t# managed by wsl2-host\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+
+	assert.Nil(t, h.RemoveEntry("api.local"))
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"172.18.192.5\tapp.local\t# managed by wsl2-host\r\n", readHosts(t, path))
+}
+
+func TestIPv6Entries(t *testing.T) {
+	path := tempHosts(t, "127.0.0.1 localhost\r\n"+
+		"::1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.5 ubuntu1804.wsl\r\n"+
+		"fd00::5 ubuntu1804.wsl\r\n"+
+		"172.18.192.6 debian.wsl\r\n"+
+		"# END wsl2-host\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+	assert.Len(t, h.Entries(), 2)
+	e := h.Entries()["ubuntu1804.wsl"]
+	assert.Equal(t, "172.18.192.5", e.IP)
+	assert.Equal(t, "fd00::5", e.IPv6)
+
+	e.IPv6 = ""
+	h.Entries()["debian.wsl"].IPv6 = "fd00::6"
+	assert.Nil(t, h.AddEntry(&HostEntry{IPv6: "fd00::7", Hostname: "alpine.wsl"}))
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"::1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"fd00::7 alpine.wsl\r\n"+
+		"172.18.192.6 debian.wsl\r\n"+
+		"fd00::6 debian.wsl\r\n"+
+		"172.18.192.5 ubuntu1804.wsl\r\n"+
+		"# END wsl2-host\r\n", readHosts(t, path))
+
+	all, err := CreateAPI(path, "")
+	assert.Nil(t, err)
+	defer all.Close()
+	assert.Equal(t, "127.0.0.1", all.Entries()["localhost"].IP)
+	assert.Equal(t, "::1", all.Entries()["localhost"].IPv6)
+}
+
+func TestWriteBackupsAndRestore(t *testing.T) {
+	original := "127.0.0.1 localhost\r\n"
+	path := tempHosts(t, original)
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+	h.SetMaxBackups(2)
+	tick := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	h.now = func() time.Time {
+		tick = tick.Add(time.Second)
+		return tick
+	}
+
+	for _, ip := range []string{"172.18.192.5", "172.18.192.6", "172.18.192.7"} {
+		h.RemoveEntry("ubuntu1804.wsl")
+		assert.Nil(t, h.AddEntry(&HostEntry{IP: ip, Hostname: "ubuntu1804.wsl", Comment: "managed by wsl2-host"}))
+		assert.Nil(t, h.Write())
+	}
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.7 ubuntu1804.wsl    # managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n", readHosts(t, path))
+
+	backups, err := h.Backups()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		path + ".wsl2host-20200101-000003.000000.bak",
+		path + ".wsl2host-20200101-000002.000000.bak",
+	}, backups)
+
+	// no temp files left behind
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	assert.Nil(t, err)
+	assert.Len(t, files, 3)
+
+	assert.Nil(t, h.Restore(filepath.Base(backups[0])))
+	assert.Equal(t, "127.0.0.1 localhost\r\n"+
+		"# BEGIN wsl2-host\r\n"+
+		"172.18.192.6 ubuntu1804.wsl    # managed by wsl2-host\r\n"+
+		"# END wsl2-host\r\n", readHosts(t, path))
+	assert.Equal(t, "172.18.192.6", h.Entries()["ubuntu1804.wsl"].IP)
+
+	assert.NotNil(t, h.Restore("missing.bak"))
+}
+
+func TestBackupReadsCurrentContent(t *testing.T) {
+	path := tempHosts(t, "127.0.0.1 localhost\r\n")
+	h, err := CreateAPI(path, "wsl2-host")
+	assert.Nil(t, err)
+	defer h.Close()
+
+	// edited by someone else after loading
+	edited := "127.0.0.1 localhost\r\n10.0.0.1 app.local\r\n"
+	err = ioutil.WriteFile(path, []byte(edited), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, h.AddEntry(&HostEntry{IP: "172.18.192.5", Hostname: "ubuntu1804.wsl", Comment: "managed by wsl2-host"}))
+	assert.Nil(t, h.Write())
+
+	backups, err := h.Backups()
+	assert.Nil(t, err)
+	if assert.Len(t, backups, 1) {
+		assert.Equal(t, edited, readHosts(t, backups[0]))
+	}
+}
+
+func TestDuplicateHostnames(t *testing.T) {
+	original := "10.0.0.1 app.local\r\n" +
+		"10.0.0.2 app.local db.local # mine\r\n" +
+		"10.0.0.3 app.local\r\n"
+	path := tempHosts(t, original)
+	h, err := CreateAPI(path, "")
+	assert.Nil(t, err)
+	defer h.Close()
+	h.SetMaxBackups(0)
+
+	assert.Equal(t, "10.0.0.1", h.Entries()["app.local"].IP)
+	assert.Equal(t, 1, h.Entries()["app.local"].LineNumber())
+	var got []string
+	for _, e := range h.Unmanaged() {
+		got = append(got, fmt.Sprintf("%d %s %s", e.LineNumber(), e.IP, e.Hostname))
+	}
+	assert.Equal(t, []string{"2 10.0.0.2 app.local", "3 10.0.0.3 app.local"}, got)
+
+	assert.Equal(t, original, string(h.Render()))
+
+	h.Entries()["db.local"].IP = "10.0.0.9"
+	assert.Equal(t, "10.0.0.1 app.local\r\n"+
+		"10.0.0.2 app.local # mine\r\n"+
+		"10.0.0.3 app.local\r\n"+
+		"10.0.0.9 db.local    # mine\r\n", string(h.Render()))
+
+	assert.Nil(t, h.RemoveEntry("db.local"))
+	assert.Nil(t, h.Write())
+	assert.Equal(t, "10.0.0.1 app.local\r\n"+
+		"10.0.0.2 app.local # mine\r\n"+
+		"10.0.0.3 app.local\r\n", readHosts(t, path))
+}
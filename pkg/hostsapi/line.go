@@ -0,0 +1,104 @@
+package hostsapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// hostsLine is an address line of the hosts file split into its
+// tokens, keeping the whitespace around them so the line can be
+// edited without reformatting what the user wrote
+type hostsLine struct {
+	idx        int
+	inblock    bool
+	indent     string // whitespace before the IP
+	ip         string
+	seps       []string // whitespace before each hostname
+	hostnames  []string
+	commentsep string // whitespace before the inline comment
+	comment    string // inline comment including the leading '#'
+}
+
+// nextToken splits s into its leading whitespace, the following
+// token and what remains after it
+func nextToken(s string) (string, string, string) {
+	start := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsSpace(r) })
+	if start < 0 {
+		return s, "", ""
+	}
+	end := strings.IndexFunc(s[start:], unicode.IsSpace)
+	if end < 0 {
+		return s[:start], s[start:], ""
+	}
+	return s[:start], s[start : start+end], s[start+end:]
+}
+
+func parseLine(idx int, line string) (*hostsLine, error) {
+	if strings.TrimSpace(line) == "" {
+		return nil, errors.New("invalid line")
+	}
+	l := &hostsLine{idx: idx}
+	indent, ip, rest := nextToken(line)
+	if ip[0] == '#' {
+		return nil, errors.New("comment line")
+	}
+	l.indent = indent
+	l.ip = ip
+	for {
+		sep, tok, after := nextToken(rest)
+		if tok == "" {
+			l.commentsep = sep
+			break
+		}
+		if tok[0] == '#' { // inline comment
+			l.commentsep = sep
+			l.comment = strings.TrimRightFunc(rest[len(sep):], unicode.IsSpace)
+			break // don't process any more
+		}
+		l.seps = append(l.seps, sep)
+		l.hostnames = append(l.hostnames, tok)
+		rest = after
+	}
+	if len(l.hostnames) == 0 {
+		return nil, fmt.Errorf("invalid fields for line: %q", strings.TrimSpace(line))
+	}
+	return l, nil
+}
+
+// commentText returns the inline comment without the '#'
+// and with whitespace normalized
+func (l *hostsLine) commentText() string {
+	return strings.Join(strings.Fields(strings.TrimLeft(l.comment, "#")), " ")
+}
+
+// render returns the line with the given IP, hostnames and comment
+// keeping the original whitespace and hostname order
+func (l *hostsLine) render(ip string, hostnames map[string]bool, comment string) string {
+	var b strings.Builder
+	b.WriteString(l.indent)
+	b.WriteString(ip)
+	for i, hostname := range l.hostnames {
+		if hostnames[hostname] {
+			b.WriteString(l.seps[i])
+			b.WriteString(hostname)
+		}
+	}
+	switch {
+	case comment == l.commentText():
+		if l.comment != "" {
+			b.WriteString(l.commentsep)
+			b.WriteString(l.comment)
+		}
+	case comment != "":
+		sep := l.commentsep
+		if sep == "" {
+			sep = "    "
+		}
+		b.WriteString(sep)
+		b.WriteString("# ")
+		b.WriteString(comment)
+	}
+	return b.String()
+}
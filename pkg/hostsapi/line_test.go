@@ -0,0 +1,40 @@
+package hostsapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	l, err := parseLine(3, " 10.0.0.1\ta  b # some  comment ")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, l.idx)
+	assert.Equal(t, "10.0.0.1", l.ip)
+	assert.Equal(t, []string{"a", "b"}, l.hostnames)
+	assert.Equal(t, "some comment", l.commentText())
+
+	l, err = parseLine(0, "10.0.0.1 a#b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a#b"}, l.hostnames)
+	assert.Equal(t, "", l.commentText())
+
+	for _, line := range []string{"", "   ", "# comment", "  #10.0.0.1 a", "10.0.0.1", "10.0.0.1 # a"} {
+		_, err = parseLine(0, line)
+		assert.NotNil(t, err, line)
+	}
+}
+
+func TestRenderLine(t *testing.T) {
+	l, err := parseLine(0, " 10.0.0.1\ta  b c\t# comment\t")
+	assert.Nil(t, err)
+	all := map[string]bool{"a": true, "b": true, "c": true}
+	assert.Equal(t, " 10.0.0.1\ta  b c\t# comment", l.render("10.0.0.1", all, "comment"))
+	assert.Equal(t, " 10.0.0.2\ta c\t# comment", l.render("10.0.0.2", map[string]bool{"a": true, "c": true}, "comment"))
+	assert.Equal(t, " 10.0.0.1  b\t# other", l.render("10.0.0.1", map[string]bool{"b": true}, "other"))
+	assert.Equal(t, " 10.0.0.1\ta  b c", l.render("10.0.0.1", all, ""))
+
+	l, err = parseLine(0, "10.0.0.1 a")
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1 a    # new", l.render("10.0.0.1", map[string]bool{"a": true}, "new"))
+}
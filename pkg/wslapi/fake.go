@@ -0,0 +1,104 @@
+package wslapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FakeRegistry is a Registry held in memory, used to exercise the
+// registry source without a Windows host
+type FakeRegistry struct {
+	values map[string]map[string]interface{}
+}
+
+// NewFakeRegistry creates an empty FakeRegistry
+func NewFakeRegistry() *FakeRegistry {
+	return &FakeRegistry{values: make(map[string]map[string]interface{})}
+}
+
+// Set records value, a string or an integer, as the value name of
+// the key at path, creating the key and its parents
+func (f *FakeRegistry) Set(path, name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+	case int:
+		value = uint64(v)
+	case uint64:
+	default:
+		panic(fmt.Sprintf("unsupported fake registry value %T", value))
+	}
+	for p := path; ; p = p[:strings.LastIndex(p, `\`)] {
+		if f.values[p] == nil {
+			f.values[p] = make(map[string]interface{})
+		}
+		if !strings.Contains(p, `\`) {
+			break
+		}
+	}
+	f.values[path][name] = value
+}
+
+// SetDistro registers a distro the way WSL does under LxssKey, id
+// being a GUID in braces
+func (f *FakeRegistry) SetDistro(id, name string, version int) {
+	path := LxssKey + `\` + id
+	flags := 0x7
+	if version == 2 {
+		flags |= lxssFlagVMMode
+	}
+	f.Set(path, "DistributionName", name)
+	f.Set(path, "BasePath", `C:\Users\user\AppData\Local\Packages\`+name+`\LocalState`)
+	f.Set(path, "Version", 2)
+	f.Set(path, "Flags", flags)
+	f.Set(path, "State", lxssStateInstalled)
+}
+
+// SubKeys returns the sorted names of the subkeys of path
+func (f *FakeRegistry) SubKeys(path string) ([]string, error) {
+	if f.values[path] == nil {
+		return nil, ErrNotExist
+	}
+	var names []string
+	for p := range f.values {
+		if strings.HasPrefix(p, path+`\`) && !strings.Contains(p[len(path)+1:], `\`) {
+			names = append(names, p[len(path)+1:])
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (f *FakeRegistry) value(path, name string) (interface{}, error) {
+	v, ok := f.values[path][name]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	return v, nil
+}
+
+// String returns the string value name of path
+func (f *FakeRegistry) String(path, name string) (string, error) {
+	v, err := f.value(path, name)
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("value %s of %s is not a string", name, path)
+	}
+	return s, nil
+}
+
+// Integer returns the integer value name of path
+func (f *FakeRegistry) Integer(path, name string) (uint64, error) {
+	v, err := f.value(path, name)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := v.(uint64)
+	if !ok {
+		return 0, fmt.Errorf("value %s of %s is not an integer", name, path)
+	}
+	return i, nil
+}
@@ -0,0 +1,126 @@
+package wslapi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// States of a distro as printed by wsl.exe in English, other
+// languages printing their own words
+const (
+	StateRunning      = "Running"
+	StateStopped      = "Stopped"
+	StateInstalling   = "Installing"
+	StateConverting   = "Converting"
+	StateUninstalling = "Uninstalling"
+)
+
+var knownStates = map[string]bool{
+	StateRunning:      true,
+	StateStopped:      true,
+	StateInstalling:   true,
+	StateConverting:   true,
+	StateUninstalling: true,
+}
+
+// columns returns the offsets in runes where the fields of the
+// header start, fields being separated by two spaces or more so
+// localized column titles may contain a space
+// wsl.exe is assumed to pad by rune count, lines padded by display
+// width that do not align being split by splitFields instead
+func columns(header []rune) []int {
+	var cols []int
+	spaces := 2
+	for i, r := range header {
+		if r == ' ' {
+			spaces++
+			continue
+		}
+		if spaces >= 2 {
+			cols = append(cols, i)
+		}
+		spaces = 0
+	}
+	return cols
+}
+
+// splitAligned splits a distro line along the columns of the
+// header, false when the line is not aligned with them
+func splitAligned(line []rune, cols []int) (name, state, version string, ok bool) {
+	if len(cols) != 3 || len(line) <= cols[2] || line[cols[1]-1] != ' ' || line[cols[2]-1] != ' ' {
+		return "", "", "", false
+	}
+	name = strings.TrimSpace(string(line[cols[0]:cols[1]]))
+	state = strings.TrimSpace(string(line[cols[1]:cols[2]]))
+	version = strings.TrimSpace(string(line[cols[2]:]))
+	return name, state, version, name != "" && state != "" && version != ""
+}
+
+// splitFields splits a distro line on its spaces, the version
+// being the last field and the name being separated from the
+// state by two spaces or more, or one when it has no space
+func splitFields(line string) (name, state, version string, ok bool) {
+	line = strings.TrimSpace(line)
+	i := strings.LastIndex(line, " ")
+	if i < 0 {
+		return "", "", "", false
+	}
+	version = line[i+1:]
+	rest := strings.TrimSpace(line[:i])
+	if j := strings.Index(rest, "  "); j >= 0 {
+		return rest[:j], strings.TrimSpace(rest[j:]), version, true
+	}
+	if j := strings.Index(rest, " "); j >= 0 {
+		return rest[:j], rest[j+1:], version, true
+	}
+	return "", "", "", false
+}
+
+// parseDistroList parses the output of "wsl.exe -l -v" whatever
+// the language of Windows, relying on the alignment of the
+// columns rather than on their titles
+// Running is only set for the English state, the State of
+// distros being otherwise the word printed by wsl.exe
+func parseDistroList(out string) ([]*DistroInfo, error) {
+	out = strings.TrimPrefix(out, "\ufeff")
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r\x00")
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) <= 1 {
+		return nil, errors.New("bad output from wslcli, cannot parse")
+	}
+	cols := columns([]rune(lines[0]))
+
+	var infos []*DistroInfo
+	for _, line := range lines[1:] {
+		info := &DistroInfo{}
+		runes := []rune(line)
+		if runes[0] == '*' {
+			info.Default = true
+			runes[0] = ' '
+		}
+		name, state, version, ok := splitAligned(runes, cols)
+		if !ok {
+			name, state, version, ok = splitFields(string(runes))
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid field length for distro: %q", line)
+		}
+		v, err := strconv.ParseInt(version, 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version for distro: %q", line)
+		}
+		info.Name = name
+		info.State = state
+		info.Running = state == StateRunning
+		info.Version = int(v)
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
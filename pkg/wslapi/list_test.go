@@ -0,0 +1,169 @@
+package wslapi
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// TestParseDistroList checks the parsing of every testdata/list/*.txt
+// against the matching .golden file, -update rewriting them
+func TestParseDistroList(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "list", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, fixtures)
+	for _, fixture := range fixtures {
+		b, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos, err := parseDistroList(string(b))
+		if !assert.Nil(t, err, fixture) {
+			continue
+		}
+		// only what the list tells
+		type listed struct {
+			Name    string
+			Running bool
+			State   string
+			Version int
+			Default bool
+		}
+		var parsed []listed
+		for _, i := range infos {
+			parsed = append(parsed, listed{i.Name, i.Running, i.State, i.Version, i.Default})
+		}
+		got, err := json.MarshalIndent(parsed, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden := strings.TrimSuffix(fixture, ".txt") + ".golden"
+		if *update {
+			err = ioutil.WriteFile(golden, append(got, '\n'), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		want, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, string(want), string(got)+"\n", fixture)
+	}
+}
+
+// TestParseDistroListWidePadding checks a Chinese listing padded
+// by rune count, as testdata/list/chinese.txt is, and padded by
+// display width, CJK characters taking two columns, parse alike
+// The fixtures are written by hand, which padding wsl.exe uses
+// not being known from a capture
+func TestParseDistroListWidePadding(t *testing.T) {
+	rows := [][]string{
+		{"  ", "名称", "状态", "版本"},
+		{"* ", "Ubuntu", "正在运行", "2"},
+		{"  ", "Debian", "已停止", "1"},
+		{"  ", "docker-desktop", "正在转换", "2"},
+	}
+	layout := func(width func(string) int) string {
+		var b strings.Builder
+		for _, row := range rows {
+			b.WriteString(row[0])
+			for _, field := range row[1:3] {
+				b.WriteString(field + strings.Repeat(" ", 18-width(field)))
+			}
+			b.WriteString(row[3] + "\r\n")
+		}
+		return b.String()
+	}
+	runes := func(s string) int { return len([]rune(s)) }
+	display := func(s string) int {
+		n := 0
+		for _, r := range s {
+			n++
+			if unicode.Is(unicode.Han, r) {
+				n++
+			}
+		}
+		return n
+	}
+
+	want := []*DistroInfo{
+		{Name: "Ubuntu", State: "正在运行", Version: 2, Default: true},
+		{Name: "Debian", State: "已停止", Version: 1},
+		{Name: "docker-desktop", State: "正在转换", Version: 2},
+	}
+	for name, width := range map[string]func(string) int{"runes": runes, "display width": display} {
+		infos, err := parseDistroList(layout(width))
+		assert.Nil(t, err, name)
+		assert.Equal(t, want, infos, name)
+	}
+}
+
+func TestParseDistroListInvalid(t *testing.T) {
+	for name, out := range map[string]string{
+		"empty":          "",
+		"no distro":      "Windows Subsystem for Linux has no installed distributions.\r\n",
+		"single field":   "  NAME      STATE     VERSION\r\n* Ubuntu\r\n",
+		"bad version":    "  NAME      STATE     VERSION\r\n* Ubuntu    Running   two\r\n",
+		"missing column": "  NAME      STATE     VERSION\r\n* Ubuntu    2\r\n",
+	} {
+		_, err := parseDistroList(out)
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestListDistrosLocalized(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "list", "german.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := wslcli.NewFakeRunner()
+	r.SetUTF16(string(b), "-l", "-v")
+	r.SetUTF16("Ubuntu-20.04\r\n", "-l", "-q", "--running")
+	infos, err := newTestAPI(r).ListDistros()
+	assert.Nil(t, err)
+	assert.Equal(t, []*DistroInfo{
+		{Name: "Ubuntu-20.04", Running: true, State: StateRunning, Version: 2, Default: true, LastSeen: testNow},
+		{Name: "Debian", State: "Beendet", Version: 2},
+	}, infos)
+	assert.Len(t, r.Calls, 2)
+
+	// English states need no second command
+	r = wslcli.NewFakeRunner()
+	b, err = ioutil.ReadFile(filepath.Join("testdata", "list", "transitional.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetUTF16(string(b), "-l", "-v")
+	infos, err = newTestAPI(r).ListDistros()
+	assert.Nil(t, err)
+	assert.Len(t, infos, 4)
+	assert.Len(t, r.Calls, 1)
+}
+
+func TestListDistrosLocalizedNoneRunning(t *testing.T) {
+	r := wslcli.NewFakeRunner()
+	r.SetUTF16("  NAME            STATUS             VERSION\r\n"+
+		"* Ubuntu-20.04    Beendet            2\r\n"+
+		"  Debian          Beendet            2\r\n", "-l", "-v")
+	// some builds of wsl.exe fail when no distro runs
+	r.SetError(exitError(1), "-l", "-q", "--running")
+	infos, err := newTestAPI(r).ListDistros()
+	assert.Nil(t, err)
+	assert.Equal(t, []*DistroInfo{
+		{Name: "Ubuntu-20.04", State: "Beendet", Version: 2, Default: true},
+		{Name: "Debian", State: "Beendet", Version: 2},
+	}, infos)
+}
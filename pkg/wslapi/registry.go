@@ -0,0 +1,175 @@
+package wslapi
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// LxssKey is where WSL keeps the distros of the current user,
+// relative to HKEY_CURRENT_USER
+const LxssKey = `Software\Microsoft\Windows\CurrentVersion\Lxss`
+
+// ErrNotExist is returned by a Registry for a missing key or value
+var ErrNotExist = errors.New("registry key or value not found")
+
+// Registry reads the registry of the current user, paths being
+// relative to HKEY_CURRENT_USER
+type Registry interface {
+	// SubKeys returns the names of the subkeys of path
+	SubKeys(path string) ([]string, error)
+	// String returns the string value name of path
+	String(path, name string) (string, error)
+	// Integer returns the DWORD or QWORD value name of path
+	Integer(path, name string) (uint64, error)
+}
+
+// Source is where ListDistros finds the distros
+type Source string
+
+const (
+	// CLISource parses the output of "wsl.exe -l -v"
+	CLISource Source = "cli"
+	// RegistrySource reads the distros from the Lxss key, wsl.exe
+	// only telling which of them run
+	RegistrySource Source = "registry"
+)
+
+// ParseSource returns the Source named s
+func ParseSource(s string) (Source, error) {
+	switch src := Source(s); src {
+	case CLISource, RegistrySource:
+		return src, nil
+	}
+	return "", fmt.Errorf("unknown distro source %q, expected %s or %s", s, CLISource, RegistrySource)
+}
+
+// States of a distro in the State value of its Lxss key, a
+// missing value meaning installed
+const (
+	lxssStateInstalled    = 1
+	lxssStateInstalling   = 3
+	lxssStateUninstalling = 4
+	lxssStateConverting   = 5
+)
+
+// lxssFlagVMMode is the flag of WSL 2 distros, the Version value
+// of their key being the version of their file system layout
+const lxssFlagVMMode = 0x8
+
+// lxssDistro is a distro as registered under LxssKey
+type lxssDistro struct {
+	ID       string // the name of its key, a GUID in braces
+	Name     string // DistributionName
+	BasePath string
+	Version  uint64
+	Flags    uint64
+	State    uint64
+}
+
+func readString(reg Registry, path, name string) (string, error) {
+	s, err := reg.String(path, name)
+	if err == ErrNotExist {
+		return "", nil
+	}
+	return s, err
+}
+
+func readInteger(reg Registry, path, name string, missing uint64) (uint64, error) {
+	v, err := reg.Integer(path, name)
+	if err == ErrNotExist {
+		return missing, nil
+	}
+	return v, err
+}
+
+// readLxss returns the distros registered under LxssKey and the ID
+// of the default one, skipping the keys without a distro name
+func readLxss(reg Registry) ([]*lxssDistro, string, error) {
+	keys, err := reg.SubKeys(LxssKey)
+	if err == ErrNotExist {
+		// WSL was never used
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", LxssKey, err)
+	}
+	def, err := readString(reg, LxssKey, "DefaultDistribution")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read default distro: %w", err)
+	}
+
+	var distros []*lxssDistro
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "{") {
+			continue
+		}
+		path := LxssKey + `\` + key
+		d := &lxssDistro{ID: key}
+		d.Name, err = readString(reg, path, "DistributionName")
+		if err == nil {
+			d.BasePath, err = readString(reg, path, "BasePath")
+		}
+		if err == nil {
+			d.Version, err = readInteger(reg, path, "Version", 0)
+		}
+		if err == nil {
+			d.Flags, err = readInteger(reg, path, "Flags", 0)
+		}
+		if err == nil {
+			d.State, err = readInteger(reg, path, "State", lxssStateInstalled)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read distro %s: %w", key, err)
+		}
+		if d.Name != "" {
+			distros = append(distros, d)
+		}
+	}
+	return distros, def, nil
+}
+
+// distroInfos maps the registered distros to DistroInfo, the
+// default one first then the others by name, running being the
+// names of the running distros
+func distroInfos(distros []*lxssDistro, def string, running []string) []*DistroInfo {
+	isRunning := make(map[string]bool)
+	for _, name := range running {
+		isRunning[strings.TrimSpace(name)] = true
+	}
+	var infos []*DistroInfo
+	for _, d := range distros {
+		info := &DistroInfo{
+			ID:      d.ID,
+			Name:    d.Name,
+			Version: 1,
+			Default: strings.EqualFold(d.ID, def),
+		}
+		if d.Flags&lxssFlagVMMode != 0 {
+			info.Version = 2
+		}
+		switch d.State {
+		case lxssStateInstalling:
+			info.State = StateInstalling
+		case lxssStateUninstalling:
+			info.State = StateUninstalling
+		case lxssStateConverting:
+			info.State = StateConverting
+		default:
+			info.State = StateStopped
+			if isRunning[d.Name] {
+				info.State = StateRunning
+				info.Running = true
+			}
+		}
+		infos = append(infos, info)
+	}
+	sort.SliceStable(infos, func(a, b int) bool {
+		if infos[a].Default != infos[b].Default {
+			return infos[a].Default
+		}
+		return infos[a].Name < infos[b].Name
+	})
+	return infos
+}
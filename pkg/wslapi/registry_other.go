@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package wslapi
+
+// defaultRegistry is nil as there is no Lxss key outside of Windows
+func defaultRegistry() Registry {
+	return nil
+}
@@ -0,0 +1,122 @@
+package wslapi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	ubuntuID = "{8a9e2cb6-3c6f-4a2e-9d43-7f6f1e1c2f01}"
+	debianID = "{0d2c7b1e-5a44-4f0e-8b3f-2f9d8a6c1b02}"
+	legacyID = "{c1b2a3d4-e5f6-4a7b-8c9d-0e1f2a3b4c03}"
+	dockerID = "{f0e1d2c3-b4a5-4968-8778-695a4b3c2d04}"
+)
+
+func fakeRegistryAPI() (*API, *FakeRegistry, *wslcli.FakeRunner) {
+	reg := NewFakeRegistry()
+	reg.Set(LxssKey, "DefaultDistribution", ubuntuID)
+	reg.SetDistro(ubuntuID, "Ubuntu-18.04", 2)
+	reg.SetDistro(debianID, "Debian", 2)
+	reg.SetDistro(legacyID, "Legacy", 1)
+	reg.SetDistro(dockerID, "docker-desktop-data", 2)
+	// keys of WSL itself are not distros
+	reg.Set(LxssKey+`\AppxInstallerCache`, "Count", 0)
+
+	r := wslcli.NewFakeRunner()
+	r.SetUTF16("Ubuntu-18.04\r\nLegacy\r\ndocker-desktop-data\r\n", "-l", "-q", "--running")
+	api := newTestAPI(r)
+	api.SetRegistry(reg)
+	api.SetSource(RegistrySource)
+	return api, reg, r
+}
+
+func TestListDistrosRegistry(t *testing.T) {
+	api, _, r := fakeRegistryAPI()
+	infos, err := api.ListDistros()
+	assert.Nil(t, err)
+	assert.Equal(t, []*DistroInfo{
+		{ID: ubuntuID, Name: "Ubuntu-18.04", Running: true, State: StateRunning, Version: 2, Default: true, LastSeen: testNow},
+		{ID: debianID, Name: "Debian", State: StateStopped, Version: 2},
+		{ID: legacyID, Name: "Legacy", Running: true, State: StateRunning, Version: 1, LastSeen: testNow},
+	}, infos)
+	assert.Equal(t, [][]string{{"-l", "-q", "--running"}}, r.Calls)
+}
+
+func TestListDistrosRegistryStates(t *testing.T) {
+	api, reg, _ := fakeRegistryAPI()
+	reg.Set(LxssKey+`\`+debianID, "State", lxssStateConverting)
+	// a distro being installed has no name yet
+	reg.Set(LxssKey+`\{00000000-0000-0000-0000-000000000005}`, "State", lxssStateInstalling)
+	// older distros have no State nor Flags
+	reg.Set(LxssKey+`\{00000000-0000-0000-0000-000000000006}`, "DistributionName", "Alpine")
+	// GUIDs compare whatever their case
+	reg.Set(LxssKey, "DefaultDistribution", "{8A9E2CB6-3C6F-4A2E-9D43-7F6F1E1C2F01}")
+
+	infos, err := api.ListDistros()
+	assert.Nil(t, err)
+	var states []string
+	for _, info := range infos {
+		states = append(states, info.Name+" "+info.State)
+	}
+	assert.Equal(t, []string{"Ubuntu-18.04 Running", "Alpine Stopped", "Debian Converting", "Legacy Running"}, states)
+	assert.True(t, infos[0].Default)
+}
+
+func TestListDistrosRegistryEmpty(t *testing.T) {
+	r := wslcli.NewFakeRunner()
+	api := newTestAPI(r)
+	api.SetRegistry(NewFakeRegistry())
+	api.SetSource(RegistrySource)
+	infos, err := api.ListDistros()
+	assert.Nil(t, err)
+	assert.Empty(t, infos)
+	assert.Empty(t, r.Calls, "nothing to ask wsl.exe")
+}
+
+// exitError is the error of a wsl.exe that exited with a failure
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitError) ExitCode() int { return int(e) }
+
+func TestListDistrosRegistryNoneRunning(t *testing.T) {
+	api, _, r := fakeRegistryAPI()
+	r.SetError(exitError(1), "-l", "-q", "--running")
+	infos, err := api.ListDistros()
+	assert.Nil(t, err)
+	var states []string
+	for _, info := range infos {
+		states = append(states, info.Name+" "+info.State)
+	}
+	assert.Equal(t, []string{"Ubuntu-18.04 Stopped", "Debian Stopped", "Legacy Stopped"}, states)
+}
+
+func TestListDistrosRegistryFailure(t *testing.T) {
+	api, reg, r := fakeRegistryAPI()
+	reg.Set(LxssKey+`\`+debianID, "DistributionName", 2)
+	_, err := api.ListDistros()
+	assert.NotNil(t, err)
+
+	api, _, r = fakeRegistryAPI()
+	r.SetError(errors.New("executable file not found"), "-l", "-q", "--running")
+	_, err = api.ListDistros()
+	assert.NotNil(t, err)
+
+	api.SetRegistry(nil)
+	_, err = api.ListDistros()
+	assert.NotNil(t, err)
+}
+
+func TestParseSource(t *testing.T) {
+	for _, s := range []Source{CLISource, RegistrySource} {
+		parsed, err := ParseSource(string(s))
+		assert.Nil(t, err)
+		assert.Equal(t, s, parsed)
+	}
+	_, err := ParseSource("wmi")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,55 @@
+//go:build windows
+// +build windows
+
+package wslapi
+
+import "golang.org/x/sys/windows/registry"
+
+// systemRegistry reads the registry of the current user
+type systemRegistry struct{}
+
+func defaultRegistry() Registry {
+	return systemRegistry{}
+}
+
+func notExist(err error) error {
+	if err == registry.ErrNotExist {
+		return ErrNotExist
+	}
+	return err
+}
+
+func (systemRegistry) open(path string) (registry.Key, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, path, registry.READ)
+	return k, notExist(err)
+}
+
+func (r systemRegistry) SubKeys(path string) ([]string, error) {
+	k, err := r.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	names, err := k.ReadSubKeyNames(-1)
+	return names, notExist(err)
+}
+
+func (r systemRegistry) String(path, name string) (string, error) {
+	k, err := r.open(path)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+	s, _, err := k.GetStringValue(name)
+	return s, notExist(err)
+}
+
+func (r systemRegistry) Integer(path, name string) (uint64, error) {
+	k, err := r.open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer k.Close()
+	v, _, err := k.GetIntegerValue(name)
+	return v, notExist(err)
+}
@@ -3,8 +3,9 @@ package wslapi
 import (
 	"errors"
 	"fmt"
-	"strconv"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/shayne/go-wsl2-host/pkg/wslcli"
 )
@@ -13,77 +14,418 @@ const dockerDesktopDistros = "docker-desktop"
 
 // DistroInfo data structure for state of a WSL distro
 type DistroInfo struct {
+	// ID is the GUID of the distro in braces, stable across
+	// renames, empty when the registry cannot be read
+	ID      string
 	Name    string
 	Running bool
+	// State is one of the State constants, or the word printed
+	// by a wsl.exe in another language for other states
+	State   string
 	Version int
 	Default bool
-	IP      string
+	IP      string // first of IPv4
+	// IPv4 are the selected addresses of the interface of IP
+	IPv4 []string
+	IPv6 []string // global addresses first, then link-local
+	// Interfaces are the network interfaces of the distro with
+	// their addresses, IPv4 being selected among them
+	Interfaces []Interface
+
+	// Details of the running WSL 2 distros, found along with
+	// their addresses
+	Hostname       string
+	DefaultUser    string
+	NetworkingMode string
+	Kernel         string
+	// BootTime is when the kernel of the distro started, the
+	// utility VM shared by all WSL 2 distros
+	BootTime time.Time
+	// LastSeen is when the distro was last found running
+	LastSeen time.Time
+	// Error is why the addresses of the distro could not be
+	// found, which are left empty
+	Error string
+}
+
+// Interface is a network interface of a distro
+type Interface struct {
+	Name string   `json:"name"`
+	IPv4 []string `json:"ipv4,omitempty"`
+	IPv6 []string `json:"ipv6,omitempty"`
+}
+
+// Networking modes of WSL 2 set in .wslconfig, WSL 1 distros
+// sharing the network of Windows
+const (
+	NetworkingNAT      = "nat"
+	NetworkingMirrored = "mirrored"
+	NetworkingHost     = "host"
+)
+
+// PreferredIPv6 returns the first global IPv6 address of the
+// distro, link-local addresses being unusable without a zone
+func (d *DistroInfo) PreferredIPv6() string {
+	for _, ip := range d.IPv6 {
+		if !strings.HasPrefix(ip, "fe80:") {
+			return ip
+		}
+	}
+	return ""
+}
+
+// API queries WSL distros through a wslcli.CLI
+type API struct {
+	cli       *wslcli.CLI
+	excludes  []string
+	source    Source
+	registry  Registry
+	wslconfig string
+	selection wslcli.Selection
+	now       func() time.Time
 }
 
+// New creates an API issuing commands through cli, listing the
+// distros from the output of wsl.exe
+func New(cli *wslcli.CLI) *API {
+	return &API{
+		cli:       cli,
+		excludes:  []string{dockerDesktopDistros},
+		source:    CLISource,
+		registry:  defaultRegistry(),
+		wslconfig: defaultWSLConfig(),
+		selection: wslcli.DefaultSelection,
+		now:       time.Now,
+	}
+}
+
+// SetSource sets where ListDistros finds the distros
+func (a *API) SetSource(source Source) {
+	a.source = source
+}
+
+// SetRegistry sets the registry read by RegistrySource and for
+// the IDs of the distros, the one of the current user by default
+func (a *API) SetRegistry(reg Registry) {
+	a.registry = reg
+}
+
+// SetSelection sets how the IPv4 addresses of the distros are
+// picked among those of their interfaces
+func (a *API) SetSelection(selection wslcli.Selection) {
+	a.selection = selection
+}
+
+// SetWSLConfig sets the path of the .wslconfig file telling the
+// networking mode, the one of the current user by default
+func (a *API) SetWSLConfig(path string) {
+	a.wslconfig = path
+}
+
+// SetExcludes sets the prefixes of the names of distros
+// ignored by GetAllInfo, docker-desktop by default, or their ID
+func (a *API) SetExcludes(excludes []string) {
+	a.excludes = excludes
+}
+
+func (a *API) excluded(info *DistroInfo) bool {
+	for _, exclude := range a.excludes {
+		if strings.HasPrefix(info.Name, exclude) || (info.ID != "" && strings.EqualFold(info.ID, exclude)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Default is the API used by the package level functions
+var Default = New(wslcli.Default)
+
 // GetAllInfo checks all distros and returns slice
 // of state info for all
 func GetAllInfo() ([]*DistroInfo, error) {
-	output, err := wslcli.ListAll()
+	return Default.GetAllInfo()
+}
+
+// Shutdown shuts down all running distros
+func Shutdown() error {
+	return Default.Shutdown()
+}
+
+// GetDefaultDistro returns the info for the default distro
+func GetDefaultDistro() (*DistroInfo, error) {
+	return Default.GetDefaultDistro()
+}
+
+// IsRunning returns whether or not a given WSL distro is running
+func IsRunning(name string) (bool, error) {
+	return Default.IsRunning(name)
+}
+
+// GetIP returns the IP address of a running WSL distro
+func GetIP(name string) (string, error) {
+	return Default.GetIP(name)
+}
+
+// GetHostAliases returns custom hosts referenced in `~/.wsl2hosts`
+// of default WSL distro
+func GetHostAliases() ([]string, error) {
+	return Default.GetHostAliases()
+}
+
+func GetHostIP(distro string, host string) (string, error) {
+	return Default.GetHostIP(distro, host)
+}
+
+func UpdateHostIP(distro string, host string, ip string) error {
+	return Default.UpdateHostIP(distro, host, ip)
+}
+
+func AddHostIP(distro string, host string, ip string) error {
+	return Default.AddHostIP(distro, host, ip)
+}
+
+func DeleteHost(distro string, host string) error {
+	return Default.DeleteHost(distro, host)
+}
+
+// AddOrUpdateHostIP makes host resolve to ip in the /etc/hosts of distro
+func AddOrUpdateHostIP(distro string, host string, ip string) error {
+	return Default.AddOrUpdateHostIP(distro, host, ip)
+}
+
+// GetAllInfo checks all distros and returns slice
+// of state info for all
+// The distros whose addresses cannot be found are returned
+// with their Error set
+func (a *API) GetAllInfo() ([]*DistroInfo, error) {
+	infos, err := a.ListDistros()
 	if err != nil {
-		return nil, fmt.Errorf("wsl list all failed: %w", err)
+		return nil, err
 	}
+	for _, info := range infos {
+		// kept in info.Error
+		_ = a.GetAddresses(info)
+	}
+	return infos, nil
+}
 
-	lines := strings.Split(output, "\r\n")
+// ListDistros returns the name, state, version and default flag
+// of all distros, without their addresses, from the Source set
+// It runs a single wsl.exe command, cheap enough to poll
+func (a *API) ListDistros() ([]*DistroInfo, error) {
+	var listed []*DistroInfo
+	var err error
+	if a.source == RegistrySource {
+		listed, err = a.listRegistry()
+	} else {
+		listed, err = a.listCLI()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.source != RegistrySource {
+		a.setIDs(listed)
+	}
+	now := a.now()
+	var infos []*DistroInfo
+	for _, info := range listed {
+		if info.Running {
+			info.LastSeen = now
+		}
+		if !a.excluded(info) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
 
-	if len(lines) <= 1 {
-		return nil, errors.New("bad output from wslcli, cannot parse")
+// setIDs sets the IDs of the distros listed by wsl.exe from the
+// registry when it can be read
+func (a *API) setIDs(infos []*DistroInfo) {
+	if a.registry == nil {
+		return
+	}
+	distros, _, err := readLxss(a.registry)
+	if err != nil {
+		return
+	}
+	ids := make(map[string]string)
+	for _, d := range distros {
+		ids[d.Name] = d.ID
+	}
+	for _, info := range infos {
+		info.ID = ids[info.Name]
 	}
+}
 
-	lines = lines[1:] // skip first header line
+// exitCoder is the error of a command that ran and failed,
+// such as *exec.ExitError
+type exitCoder interface {
+	ExitCode() int
+}
 
-	var infos []*DistroInfo
-	for _, line := range lines {
-		info := &DistroInfo{}
-		if len(line) <= 0 {
-			continue
-		}
-		if line[0] == '*' {
-			line = line[1:]
-			info.Default = true
+// runningDistros returns the names of the running distros, none
+// when wsl.exe fails as some builds do when no distro runs
+func (a *API) runningDistros() ([]string, error) {
+	running, err := a.cli.RunningDistros()
+	var exit exitCoder
+	if errors.As(err, &exit) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("running distros failed: %w", err)
+	}
+	return running, nil
+}
+
+// listRegistry reads the distros from the Lxss key, asking
+// wsl.exe which of them run
+func (a *API) listRegistry() ([]*DistroInfo, error) {
+	if a.registry == nil {
+		return nil, errors.New("the registry distro source is only available on Windows")
+	}
+	distros, def, err := readLxss(a.registry)
+	if err != nil {
+		return nil, err
+	}
+	if len(distros) == 0 {
+		return nil, nil
+	}
+	running, err := a.runningDistros()
+	if err != nil {
+		return nil, err
+	}
+	return distroInfos(distros, def, running), nil
+}
+
+// listCLI parses the output of "wsl.exe -l -v", asking which
+// distros run when it is not in English
+func (a *API) listCLI() ([]*DistroInfo, error) {
+	output, err := a.cli.ListAll()
+	if err != nil {
+		return nil, fmt.Errorf("wsl list all failed: %w", err)
+	}
+	listed, err := parseDistroList(output)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown bool
+	for _, info := range listed {
+		unknown = unknown || !knownStates[info.State]
+	}
+	if !unknown {
+		return listed, nil
+	}
+
+	// a state in another language, ask which distros run
+	running, err := a.runningDistros()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range listed {
+		info.Running = false
+		for _, name := range running {
+			if strings.TrimSpace(name) == info.Name {
+				info.Running = true
+				info.State = StateRunning
+			}
 		}
-		line = strings.TrimSpace(line)
-		fields := strings.Fields(line)
-		if len(fields) != 3 {
-			return nil, fmt.Errorf("invalid field length for distro: %q", line)
+	}
+	return listed, nil
+}
+
+// GetAddresses fills in the addresses and the details of a
+// distro listed by ListDistros, left empty when it is stopped
+// It runs a single wsl.exe command per running distro, its
+// error being kept in Error
+func (a *API) GetAddresses(info *DistroInfo) error {
+	info.IP = ""
+	info.IPv4 = nil
+	info.IPv6 = nil
+	info.Interfaces = nil
+	info.Hostname = ""
+	info.DefaultUser = ""
+	info.NetworkingMode = ""
+	info.Kernel = ""
+	info.BootTime = time.Time{}
+	info.Error = ""
+	if info.Version == 1 {
+		info.IP = "127.0.0.1"
+		info.IPv4 = []string{info.IP}
+		info.NetworkingMode = NetworkingHost
+		return nil
+	}
+	if !info.Running {
+		return nil
+	}
+	d, err := a.cli.Discover(info.Name)
+	if err != nil {
+		err = fmt.Errorf("failed to get IP for distro %q: %v", info.Name, err)
+		info.Error = err.Error()
+		return err
+	}
+	info.Hostname = d.Hostname
+	info.DefaultUser = d.User
+	info.Kernel = d.Kernel
+	info.BootTime = a.now().Add(-d.Uptime).Round(time.Second)
+	info.NetworkingMode = readNetworkingMode(a.wslconfig)
+	interfaces := make(map[string]*Interface)
+	iface := func(name string) *Interface {
+		if interfaces[name] == nil {
+			interfaces[name] = &Interface{Name: name}
 		}
-		info.Name = fields[0]
-		if strings.HasPrefix(info.Name, dockerDesktopDistros) {
+		return interfaces[name]
+	}
+	for _, addr := range d.IPv4 {
+		// no route tells the interface of the address
+		if addr.Interface == "" {
 			continue
 		}
-		info.Running = fields[1] == "Running"
-		version, err := strconv.ParseInt(fields[2], 10, 0)
-		if err != nil {
-			return nil, fmt.Errorf("invalid version for distro: %q", line)
-		}
-		info.Version = int(version)
-
-		if info.Version == 1 {
-			info.IP = "127.0.0.1"
-		} else if info.Running {
-			info.IP, err = GetIP(info.Name)
-			if err != nil {
-				return nil, fmt.Errorf("failed to get IP for distro %q: %v", info.Name, err)
+		i := iface(addr.Interface)
+		i.IPv4 = append(i.IPv4, addr.IP)
+	}
+	// the selected addresses of the interface of IP, those of the
+	// other interfaces, e.g. docker0, being left to Interfaces
+	ipv6Interface := wslcli.DefaultInterface
+	selected := a.selection.Select(d.IPv4)
+	if len(selected) > 0 {
+		chosen := selected[0]
+		info.IP = chosen.IP
+		ipv6Interface = chosen.Interface
+		for _, addr := range selected {
+			if addr.IP == chosen.IP || (chosen.Interface != "" && addr.Interface == chosen.Interface) {
+				info.IPv4 = append(info.IPv4, addr.IP)
 			}
 		}
-
-		infos = append(infos, info)
 	}
-
-	return infos, nil
+	for _, addr := range d.IPv6 {
+		if addr.Interface == ipv6Interface {
+			info.IPv6 = append(info.IPv6, addr.IP)
+		}
+		i := iface(addr.Interface)
+		i.IPv6 = append(i.IPv6, addr.IP)
+	}
+	for _, i := range interfaces {
+		info.Interfaces = append(info.Interfaces, *i)
+	}
+	sort.Slice(info.Interfaces, func(a, b int) bool { return info.Interfaces[a].Name < info.Interfaces[b].Name })
+	if info.IP == "" {
+		err = fmt.Errorf("no IPv4 address selected for distro %q among %d", info.Name, len(d.IPv4))
+		info.Error = err.Error()
+		return err
+	}
+	return nil
 }
 
-func Shutdown() error {
-	return wslcli.Shutdown()
+// Shutdown shuts down all running distros
+func (a *API) Shutdown() error {
+	return a.cli.Shutdown()
 }
 
 // GetDefaultDistro returns the info for the default distro
-func GetDefaultDistro() (*DistroInfo, error) {
-	infos, err := GetAllInfo()
+func (a *API) GetDefaultDistro() (*DistroInfo, error) {
+	infos, err := a.GetAllInfo()
 	if err != nil {
 		return nil, fmt.Errorf("GetAllInfo failed: %w", err)
 	}
@@ -96,8 +438,8 @@ func GetDefaultDistro() (*DistroInfo, error) {
 }
 
 // IsRunning returns whether or not a given WSL distro is running
-func IsRunning(name string) (bool, error) {
-	running, err := wslcli.RunningDistros()
+func (a *API) IsRunning(name string) (bool, error) {
+	running, err := a.cli.RunningDistros()
 	if err != nil {
 		return false, fmt.Errorf("running distros failed: %w", err)
 	}
@@ -110,28 +452,40 @@ func IsRunning(name string) (bool, error) {
 }
 
 // GetIP returns the IP address of a running WSL distro
-func GetIP(name string) (string, error) {
-	running, err := IsRunning(name)
+func (a *API) GetIP(name string) (string, error) {
+	running, err := a.IsRunning(name)
 	if err != nil {
 		return "", fmt.Errorf("IsRunning failed: %w", err)
 	}
 	if !running {
 		return "", fmt.Errorf("GetIP failed, distro '%s' is not running", name)
 	}
-	return wslcli.GetIP(name)
+	return a.cli.GetIP(name)
 }
 
 // GetHostAliases returns custom hosts referenced in `~/.wsl2hosts`
 // of default WSL distro
-func GetHostAliases() ([]string, error) {
-	info, err := GetDefaultDistro()
+func (a *API) GetHostAliases() ([]string, error) {
+	return a.GetHostAliasesFrom("~/.wsl2hosts")
+}
+
+// GetHostAliasesFrom returns custom hosts referenced in file
+// of default WSL distro
+func (a *API) GetHostAliasesFrom(file string) ([]string, error) {
+	infos, err := a.ListDistros()
 	if err != nil {
-		return nil, fmt.Errorf("GetDefaultDistro failed: %w", err)
+		return nil, err
 	}
-	if !info.Running {
+	var running bool
+	for _, i := range infos {
+		if i.Default {
+			running = i.Running
+		}
+	}
+	if !running {
 		return nil, errors.New("default distro not running")
 	}
-	out, err := wslcli.RunCommand("cat", "~/.wsl2hosts")
+	out, err := a.cli.RunCommand("cat", file)
 	if err != nil {
 		return nil, fmt.Errorf("RunCommand failed: %w", err)
 	}
@@ -142,24 +496,35 @@ func GetHostAliases() ([]string, error) {
 	return strings.Split(out, " "), nil
 }
 
-func GetHostIP(distro string, host string) (string, error) {
-	return wslcli.GetHostIPFromHosts(distro, host)
+// ReadHosts returns the content of the /etc/hosts of distro
+func (a *API) ReadHosts(distro string) (string, error) {
+	return a.cli.ReadHosts(distro)
 }
 
-func UpdateHostIP(distro string, host string, ip string) error {
-	return wslcli.UpdateHostIP(distro, host, ip)
+// GetHosts maps the hostnames of the /etc/hosts of distro to their IP
+func (a *API) GetHosts(distro string) (map[string]string, error) {
+	return a.cli.GetHosts(distro)
 }
 
-func AddHostIP(distro string, host string, ip string) error {
-	return wslcli.AddHostIP(distro, host, ip)
+func (a *API) GetHostIP(distro string, host string) (string, error) {
+	return a.cli.GetHostIPFromHosts(distro, host)
 }
 
-func DeleteHost(distro string, host string) error {
-	return wslcli.DeleteHost(distro, host)
+func (a *API) UpdateHostIP(distro string, host string, ip string) error {
+	return a.cli.UpdateHostIP(distro, host, ip)
 }
 
-func AddOrUpdateHostIP(distro string, host string, ip string) error {
-	old_ip, err := GetHostIP(distro, host)
+func (a *API) AddHostIP(distro string, host string, ip string) error {
+	return a.cli.AddHostIP(distro, host, ip)
+}
+
+func (a *API) DeleteHost(distro string, host string) error {
+	return a.cli.DeleteHost(distro, host)
+}
+
+// AddOrUpdateHostIP makes host resolve to ip in the /etc/hosts of distro
+func (a *API) AddOrUpdateHostIP(distro string, host string, ip string) error {
+	old_ip, err := a.GetHostIP(distro, host)
 	if err != nil {
 		return err
 	}
@@ -167,9 +532,9 @@ func AddOrUpdateHostIP(distro string, host string, ip string) error {
 		return nil
 	}
 	if len(old_ip) == 0 {
-		return AddHostIP(distro, host, ip)
+		return a.AddHostIP(distro, host, ip)
 	} else if old_ip != ip {
-		return UpdateHostIP(distro, host, ip)
+		return a.UpdateHostIP(distro, host, ip)
 	}
 	return nil
 }
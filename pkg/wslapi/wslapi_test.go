@@ -0,0 +1,212 @@
+package wslapi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shayne/go-wsl2-host/pkg/wslcli"
+	"github.com/stretchr/testify/assert"
+)
+
+const listAll = "  NAME                   STATE           VERSION\r\n" +
+	"* Ubuntu-18.04           Running         2\r\n" +
+	"  Debian                 Stopped         2\r\n" +
+	"  Legacy                 Running         1\r\n" +
+	"  docker-desktop-data    Running         2\r\n"
+
+var testNow = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestAPI creates an API running r at testNow, without a
+// registry or a .wslconfig
+func newTestAPI(r *wslcli.FakeRunner) *API {
+	api := New(wslcli.New(r))
+	api.SetRegistry(nil)
+	api.SetWSLConfig("")
+	api.now = func() time.Time { return testNow }
+	return api
+}
+
+func fakeAPI() (*API, *wslcli.FakeRunner) {
+	r := wslcli.NewFakeRunner()
+	r.SetUTF16(listAll, "-l", "-v")
+	r.SetUTF16("Ubuntu-18.04\r\nLegacy\r\ndocker-desktop-data\r\n", "-l", "-q", "--running")
+	r.SetDiscovery("Ubuntu-18.04", "ubuntu",
+		"Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n"+
+			"eth0\t00C012AC\t00000000\t0001\t0\t0\t0\t00F0FFFF\t0\t0\t0\n",
+		"Local:\n"+
+			"     +-- 172.18.192.0/20 2 0 2\n"+
+			"           |-- 172.18.192.5\n"+
+			"              /32 host LOCAL\n",
+		"fe80000000000000021554fffe7b9a1c 02 40 20 80     eth0\n"+
+			"20010db800000001021554fffe7b9a1c 02 40 00 00     eth0\n")
+	r.Set("app.local api.local\n", "--", "bash", "-c", "cat ~/.wsl2hosts")
+	return newTestAPI(r), r
+}
+
+func TestGetAllInfo(t *testing.T) {
+	api, r := fakeAPI()
+	infos, err := api.GetAllInfo()
+	assert.Nil(t, err)
+	// the list, then one command per running WSL 2 distro
+	assert.Len(t, r.Calls, 2)
+	assert.Equal(t, []*DistroInfo{
+		{Name: "Ubuntu-18.04", Running: true, State: StateRunning, Version: 2, Default: true, IP: "172.18.192.5",
+			IPv4: []string{"172.18.192.5"},
+			IPv6: []string{"2001:db8:0:1:215:54ff:fe7b:9a1c", "fe80::215:54ff:fe7b:9a1c"},
+			Interfaces: []Interface{{Name: "eth0", IPv4: []string{"172.18.192.5"},
+				IPv6: []string{"2001:db8:0:1:215:54ff:fe7b:9a1c", "fe80::215:54ff:fe7b:9a1c"}}},
+			Hostname: "ubuntu", DefaultUser: wslcli.FakeUser, NetworkingMode: NetworkingNAT, Kernel: wslcli.FakeKernel,
+			BootTime: testNow.Add(-time.Hour), LastSeen: testNow},
+		{Name: "Debian", Running: false, State: StateStopped, Version: 2},
+		{Name: "Legacy", Running: true, State: StateRunning, Version: 1, IP: "127.0.0.1", IPv4: []string{"127.0.0.1"},
+			NetworkingMode: NetworkingHost, LastSeen: testNow},
+	}, infos)
+	assert.Equal(t, "2001:db8:0:1:215:54ff:fe7b:9a1c", infos[0].PreferredIPv6())
+	assert.Equal(t, "", infos[2].PreferredIPv6())
+}
+
+func TestGetAllInfoExcludes(t *testing.T) {
+	api, _ := fakeAPI()
+	api.SetExcludes([]string{"docker-desktop", "Leg"})
+	infos, err := api.GetAllInfo()
+	assert.Nil(t, err)
+	var names []string
+	for _, i := range infos {
+		names = append(names, i.Name)
+	}
+	assert.Equal(t, []string{"Ubuntu-18.04", "Debian"}, names)
+}
+
+func TestGetDefaultDistro(t *testing.T) {
+	api, _ := fakeAPI()
+	info, err := api.GetDefaultDistro()
+	assert.Nil(t, err)
+	assert.Equal(t, "Ubuntu-18.04", info.Name)
+}
+
+func TestGetHostAliases(t *testing.T) {
+	api, _ := fakeAPI()
+	aliases, err := api.GetHostAliases()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"app.local", "api.local"}, aliases)
+
+	_, err = api.GetHostAliasesFrom("/etc/aliases")
+	assert.NotNil(t, err)
+}
+
+func TestListDistros(t *testing.T) {
+	api, r := fakeAPI()
+	infos, err := api.ListDistros()
+	assert.Nil(t, err)
+	assert.Equal(t, []*DistroInfo{
+		{Name: "Ubuntu-18.04", Running: true, State: StateRunning, Version: 2, Default: true, LastSeen: testNow},
+		{Name: "Debian", Running: false, State: StateStopped, Version: 2},
+		{Name: "Legacy", Running: true, State: StateRunning, Version: 1, LastSeen: testNow},
+	}, infos)
+	assert.Len(t, r.Calls, 1, "a single wsl.exe command")
+
+	err = api.GetAddresses(infos[0])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"172.18.192.5"}, infos[0].IPv4)
+	err = api.GetAddresses(infos[1])
+	assert.Nil(t, err)
+	assert.Empty(t, infos[1].IP)
+}
+
+func TestGetAllInfoDiscoveryError(t *testing.T) {
+	api, r := fakeAPI()
+	r.SetUTF16(listAll+"  Fedora                 Running         2\r\n", "-l", "-v")
+	infos, err := api.GetAllInfo()
+	assert.Nil(t, err)
+	assert.Len(t, infos, 4)
+	assert.Equal(t, "172.18.192.5", infos[0].IP)
+	assert.Equal(t, "Fedora", infos[3].Name)
+	assert.Empty(t, infos[3].IP)
+	assert.Contains(t, infos[3].Error, `failed to get IP for distro "Fedora"`)
+}
+
+func TestExcludeID(t *testing.T) {
+	api, _ := fakeAPI()
+	reg := NewFakeRegistry()
+	reg.SetDistro("{0d2c7b1e-5a44-4f0e-8b3f-2f9d8a6c1b02}", "Debian", 2)
+	api.SetRegistry(reg)
+	api.SetExcludes([]string{"{0D2C7B1E-5A44-4F0E-8B3F-2F9D8A6C1B02}"})
+	infos, err := api.ListDistros()
+	assert.Nil(t, err)
+	var names []string
+	for _, i := range infos {
+		names = append(names, i.Name)
+	}
+	assert.Equal(t, []string{"Ubuntu-18.04", "Legacy", "docker-desktop-data"}, names)
+}
+
+func TestReadNetworkingMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wslconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ".wslconfig")
+	assert.Equal(t, NetworkingNAT, readNetworkingMode(path))
+
+	err = ioutil.WriteFile(path, []byte("[wsl2]\r\nmemory=4GB\r\n# networkingMode=bridged\r\n"+
+		"networkingMode = Mirrored # since 2023\r\n[experimental]\r\nnetworkingMode=nat\r\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, NetworkingMirrored, readNetworkingMode(path))
+}
+
+func TestGetAddressesSelection(t *testing.T) {
+	r := wslcli.NewFakeRunner()
+	r.SetDiscovery("Ubuntu", "ubuntu",
+		"Iface\tDestination\tGateway\tFlags\tRefCnt\tUse\tMetric\tMask\tMTU\tWindow\tIRTT\n"+
+			"eth0\t00000000\t01501DAC\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"+
+			"eth0\t00501DAC\t00000000\t0001\t0\t0\t0\t00F0FFFF\t0\t0\t0\n"+
+			"docker0\t000011AC\t00000000\t0001\t0\t0\t0\t0000FFFF\t0\t0\t0\n",
+		"Local:\n"+
+			"           |-- 172.17.0.1\n"+
+			"              /32 host LOCAL\n"+
+			"           |-- 172.29.86.123\n"+
+			"              /32 host LOCAL\n"+
+			"           |-- 10.255.255.1\n"+
+			"              /32 host LOCAL\n",
+		"fd000000000000000000000000000001 03 40 00 00  docker0\n")
+	api := newTestAPI(r)
+	info := &DistroInfo{Name: "Ubuntu", Running: true, Version: 2}
+
+	assert.Nil(t, api.GetAddresses(info))
+	assert.Equal(t, "172.29.86.123", info.IP, "the default route")
+	assert.Equal(t, []string{"172.29.86.123"}, info.IPv4, "docker0 left to Interfaces")
+	assert.Empty(t, info.IPv6)
+	// 10.255.255.1 has no route to tell its interface
+	assert.Equal(t, []Interface{
+		{Name: "docker0", IPv4: []string{"172.17.0.1"}, IPv6: []string{"fd00::1"}},
+		{Name: "eth0", IPv4: []string{"172.29.86.123"}},
+	}, info.Interfaces)
+
+	selection, err := wslcli.ParseSelection([]string{"docker*"}, nil, true)
+	assert.Nil(t, err)
+	api.SetSelection(selection)
+	assert.Nil(t, api.GetAddresses(info))
+	assert.Equal(t, "172.17.0.1", info.IP)
+	assert.Equal(t, []string{"fd00::1"}, info.IPv6)
+
+	selection, err = wslcli.ParseSelection(nil, []string{"10.0.0.0/8"}, true)
+	assert.Nil(t, err)
+	api.SetSelection(selection)
+	assert.Nil(t, api.GetAddresses(info))
+	assert.Equal(t, "10.255.255.1", info.IP)
+	assert.Equal(t, []string{"10.255.255.1"}, info.IPv4)
+
+	selection, err = wslcli.ParseSelection([]string{"*"}, []string{"10.0.0.0/8"}, true)
+	assert.Nil(t, err)
+	api.SetSelection(selection)
+	assert.NotNil(t, api.GetAddresses(info))
+	assert.Empty(t, info.IP)
+	assert.Equal(t, `no IPv4 address selected for distro "Ubuntu" among 3`, info.Error)
+	assert.Len(t, info.Interfaces, 2, "the interfaces are still told")
+}
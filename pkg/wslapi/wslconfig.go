@@ -0,0 +1,57 @@
+package wslapi
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultWSLConfig returns the path of the .wslconfig file of
+// the current user, empty when there is no home
+func defaultWSLConfig() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".wslconfig")
+}
+
+// readNetworkingMode returns the networkingMode of the [wsl2]
+// section of the .wslconfig file at path, lower cased, NAT
+// being the default when it is missing
+func readNetworkingMode(path string) string {
+	mode := NetworkingNAT
+	if path == "" {
+		return mode
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return mode
+	}
+	defer f.Close()
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if section != "wsl2" || len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "networkingMode") {
+			continue
+		}
+		value := kv[1]
+		if i := strings.IndexAny(value, "#;"); i >= 0 {
+			value = value[:i]
+		}
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			mode = value
+		}
+	}
+	return mode
+}
@@ -0,0 +1,166 @@
+package wslcli
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiscoveryVersion is the version of the output of discoveryScript,
+// to be bumped whenever its sections change
+const DiscoveryVersion = 2
+
+// discoveryHeader starts the output of discoveryScript, followed
+// by its version
+const discoveryHeader = "wsl2host-discovery"
+
+// discoveryScript prints what Discover needs in a single run, as
+// sections of the form "[name]" followed by the content of a file
+// It is run without a shell by wsl.exe, so it avoids anything the
+// Windows command line would mangle such as "$"
+var discoveryScript = strings.Join([]string{
+	fmt.Sprintf("echo '%s %d'", discoveryHeader, DiscoveryVersion),
+	"echo '[hostname]'", "cat /proc/sys/kernel/hostname",
+	// run without -u, the command runs as the default user
+	"echo '[user]'", "id -un",
+	"echo '[kernel]'", "cat /proc/sys/kernel/osrelease",
+	"echo '[uptime]'", "cat /proc/uptime",
+	"echo '[route]'", "cat /proc/net/route",
+	"echo '[fib_trie]'", "cat /proc/net/fib_trie",
+	// IPv6 is commonly disabled, leaving no if_inet6
+	"echo '[if_inet6]'", "cat /proc/net/if_inet6 2>/dev/null",
+	"echo '[end]'",
+}, "; ")
+
+// Discovery is what a distro tells about itself
+type Discovery struct {
+	Hostname string
+	// User is the default user of the distro
+	User string
+	// Kernel is the release of the running kernel
+	Kernel string
+	// Uptime is the time since the kernel started, that of the
+	// utility VM shared by all WSL 2 distros
+	Uptime time.Duration
+	// IP is the address picked by DefaultSelection, empty when
+	// there is none
+	IP string
+	// IPv4 are the local addresses of all interfaces
+	IPv4 []IPv4Address
+	// IPv6 are the addresses found by GetIPv6
+	IPv6 []IPv6Address
+}
+
+// Discover finds the hostname and the addresses of the given
+// distro with a single wsl.exe command
+// Suggest check if running before calling this function as
+// it has the side-effect of starting the distro
+func (c *CLI) Discover(name string) (*Discovery, error) {
+	out, err := c.runner.Run("-d", name, "-e", "sh", "-c", discoveryScript)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	return parseDiscovery(string(out))
+}
+
+// Discover finds the hostname and the addresses of the given distro
+func Discover(name string) (*Discovery, error) {
+	return Default.Discover(name)
+}
+
+// parseSections splits the output of discoveryScript into its
+// sections, checking its version and that it is complete
+func parseSections(out string) (map[string]string, error) {
+	lines := strings.Split(strings.Replace(out, "\r\n", "\n", -1), "\n")
+	fail := func(line int, text string, err error) error {
+		return &ParseError{File: "discovery", Line: line, Text: text, Err: err}
+	}
+	header := strings.Fields(lines[0])
+	if len(header) != 2 || header[0] != discoveryHeader {
+		return nil, fail(1, lines[0], ErrMissingHeader)
+	}
+	version, err := strconv.Atoi(header[1])
+	if err != nil {
+		return nil, fail(1, header[1], ErrInvalidVersion)
+	}
+	if version != DiscoveryVersion {
+		return nil, fail(1, header[1], fmt.Errorf("%w, expected %d", ErrUnsupportedVersion, DiscoveryVersion))
+	}
+
+	sections := make(map[string]string)
+	var name string
+	var content []string
+	for i, line := range lines[1:] {
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if name != "" {
+				sections[name] = strings.Join(content, "\n")
+			}
+			name = line[1 : len(line)-1]
+			content = nil
+			if name == "end" {
+				return sections, nil
+			}
+			continue
+		}
+		if name == "" {
+			return nil, fail(i+2, line, ErrUnexpectedLine)
+		}
+		content = append(content, line)
+	}
+	return nil, fail(0, "", ErrTruncated)
+}
+
+// parseDiscovery parses the output of discoveryScript
+func parseDiscovery(out string) (*Discovery, error) {
+	sections, err := parseSections(out)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"hostname", "user", "kernel", "uptime", "route", "fib_trie", "if_inet6"} {
+		if _, exists := sections[name]; !exists {
+			return nil, &ParseError{File: "discovery", Err: fmt.Errorf("%w %s", ErrMissingSection, name)}
+		}
+	}
+
+	d := &Discovery{
+		Hostname: strings.TrimSpace(sections["hostname"]),
+		User:     strings.TrimSpace(sections["user"]),
+		Kernel:   strings.TrimSpace(sections["kernel"]),
+	}
+	d.Uptime, err = parseUptime(sections["uptime"])
+	if err != nil {
+		return nil, err
+	}
+	d.IPv4, err = ipv4Candidates(sections["route"], sections["fib_trie"])
+	if err != nil {
+		return nil, err
+	}
+	if selected := DefaultSelection.Select(d.IPv4); len(selected) > 0 {
+		d.IP = selected[0].IP
+	}
+	d.IPv6, err = parseIfInet6(sections["if_inet6"])
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// parseUptime parses /proc/uptime, the seconds since the kernel
+// started followed by the idle time
+func parseUptime(out string) (time.Duration, error) {
+	fail := func(err error) error {
+		return &ParseError{File: "uptime", Line: 1, Text: strings.TrimSpace(out), Err: err}
+	}
+	fs := strings.Fields(out)
+	if len(fs) != 2 {
+		return 0, fail(ErrMissingFields)
+	}
+	secs, err := strconv.ParseFloat(fs[0], 64)
+	// NaN and what overflows a Duration are rejected too
+	if err != nil || !(secs >= 0 && secs < math.MaxInt64/float64(time.Second)) {
+		return 0, fail(ErrInvalidNumber)
+	}
+	return time.Duration(secs * float64(time.Second)).Round(10 * time.Millisecond), nil
+}
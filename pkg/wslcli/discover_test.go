@@ -0,0 +1,87 @@
+package wslcli
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscover(t *testing.T) {
+	r := NewFakeRunner()
+	r.Set(fixture(t, "discovery.txt"), "-d", "Ubuntu-18.04", "-e", "sh", "-c", discoveryScript)
+	d, err := New(r).Discover("Ubuntu-18.04")
+	assert.Nil(t, err)
+	assert.Equal(t, &Discovery{
+		Hostname: "DESKTOP-1234",
+		User:     "shayne",
+		Kernel:   "5.10.102.1-microsoft-standard-WSL2",
+		Uptime:   5412370 * time.Millisecond,
+		IP:       "172.18.192.5",
+		IPv4: []IPv4Address{
+			{IP: "172.18.192.5", Interface: "eth0", Network: "172.18.192.0/20", Default: true},
+		},
+		IPv6: []IPv6Address{
+			{IP: "2001:db8:0:1:215:54ff:fe7b:9a1c", Interface: "eth0"},
+			{IP: "fd00::a", Interface: "docker0"},
+			{IP: "fe80::215:54ff:fe7b:9a1c", Interface: "eth0", LinkLocal: true},
+		},
+	}, d)
+	assert.Len(t, r.Calls, 1)
+
+	_, err = New(r).Discover("Debian")
+	assert.NotNil(t, err)
+}
+
+func TestDiscoveryScript(t *testing.T) {
+	assert.True(t, strings.HasPrefix(discoveryScript, "echo 'wsl2host-discovery 2'; "))
+	assert.NotContains(t, discoveryScript, "$")
+	assert.NotContains(t, discoveryScript, `"`)
+}
+
+func TestParseDiscovery(t *testing.T) {
+	full := fixture(t, "discovery.txt")
+
+	// CRLF line endings and no IPv6
+	withoutIPv6 := full[:strings.Index(full, "[if_inet6]\n")] + "[if_inet6]\n[end]\n"
+	d, err := parseDiscovery(strings.Replace(withoutIPv6, "\n", "\r\n", -1))
+	assert.Nil(t, err)
+	assert.Equal(t, "172.18.192.5", d.IP)
+	assert.Empty(t, d.IPv6)
+
+	tests := map[string]struct {
+		out  string
+		file string
+		err  error
+		msg  string
+	}{
+		"empty":         {"", "discovery", ErrMissingHeader, `invalid discovery line 1: "": missing header`},
+		"other program": {"hello\n", "discovery", ErrMissingHeader, `invalid discovery line 1: "hello": missing header`},
+		"bad version":   {"wsl2host-discovery one\n", "discovery", ErrInvalidVersion, `invalid discovery line 1: "one": invalid version`},
+		"older version": {strings.Replace(full, "wsl2host-discovery 2", "wsl2host-discovery 1", 1), "discovery", ErrUnsupportedVersion,
+			`invalid discovery line 1: "1": unsupported version, expected 2`},
+		"truncated": {full[:strings.Index(full, "[fib_trie]")], "discovery", ErrTruncated, "invalid discovery: truncated output"},
+		"missing section": {strings.Replace(full, "[fib_trie]", "[fib]", 1), "discovery", ErrMissingSection,
+			"invalid discovery: missing section fib_trie"},
+		"stray line": {"wsl2host-discovery 2\nnoise\n[end]\n", "discovery", ErrUnexpectedLine,
+			`invalid discovery line 2: "noise": unexpected line`},
+		"bad uptime": {strings.Replace(full, "5412.37 21329.72", "soon", 1), "uptime", ErrMissingFields,
+			`invalid uptime line 1: "soon": missing fields`},
+		"infinite uptime": {strings.Replace(full, "5412.37 21329.72", "Inf 0", 1), "uptime", ErrInvalidNumber,
+			`invalid uptime line 1: "Inf 0": invalid number`},
+		"bad route": {strings.Replace(full, "0003", "up", 1), "route", ErrInvalidHex, ""},
+	}
+	for name, tc := range tests {
+		_, err := parseDiscovery(tc.out)
+		var perr *ParseError
+		if assert.True(t, errors.As(err, &perr), name) {
+			assert.Equal(t, tc.file, perr.File, name)
+			assert.True(t, errors.Is(err, tc.err), name)
+		}
+		if tc.msg != "" {
+			assert.EqualError(t, err, tc.msg, name)
+		}
+	}
+}
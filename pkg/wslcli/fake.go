@@ -0,0 +1,100 @@
+package wslcli
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+// FakeRunner is a Runner replaying recorded wsl.exe outputs,
+// used to exercise the package without a Windows host
+type FakeRunner struct {
+	outputs map[string][]byte
+	errors  map[string]error
+	// Calls records the arguments of every Run in order
+	Calls [][]string
+}
+
+// NewFakeRunner creates an empty FakeRunner
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		outputs: make(map[string][]byte),
+		errors:  make(map[string]error),
+	}
+}
+
+func fakeKey(args []string) string {
+	return strings.Join(args, " ")
+}
+
+// Set records output to be returned when Run is called with args
+func (f *FakeRunner) Set(output string, args ...string) {
+	f.outputs[fakeKey(args)] = []byte(output)
+}
+
+// SetUTF16 records output encoded as UTF-16LE, the way wsl.exe
+// prints its own messages such as the distro list
+func (f *FakeRunner) SetUTF16(output string, args ...string) {
+	encoded, err := unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().String(output)
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode fake output: %v", err))
+	}
+	f.outputs[fakeKey(args)] = []byte(encoded)
+}
+
+// SetError records err to be returned when Run is called with args
+func (f *FakeRunner) SetError(err error, args ...string) {
+	f.errors[fakeKey(args)] = err
+}
+
+// Run returns the recorded output for args, or an error when
+// nothing was recorded
+func (f *FakeRunner) Run(args ...string) ([]byte, error) {
+	f.Calls = append(f.Calls, args)
+	key := fakeKey(args)
+	if err, ok := f.errors[key]; ok {
+		return nil, err
+	}
+	if out, ok := f.outputs[key]; ok {
+		return out, nil
+	}
+	return nil, fmt.Errorf("no recorded output for: wsl.exe %s", key)
+}
+
+// Discovery details recorded by SetDiscovery
+const (
+	FakeUser   = "user"
+	FakeKernel = "5.15.90.1-microsoft-standard-WSL2"
+	FakeUptime = "3600.25 14000.50"
+)
+
+// SetDiscovery records the output of Discover for distro, made
+// of the content of the files it reads, its user, kernel and
+// uptime being the Fake constants
+func (f *FakeRunner) SetDiscovery(distro, hostname, route, fibTrie, ifInet6 string) {
+	f.Set(fakeDiscovery(hostname, route, fibTrie, ifInet6), "-d", distro, "-e", "sh", "-c", discoveryScript)
+}
+
+// fakeDiscovery returns the output of discoveryScript recorded
+// by SetDiscovery
+func fakeDiscovery(hostname, route, fibTrie, ifInet6 string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d\n", discoveryHeader, DiscoveryVersion)
+	for _, s := range []struct{ name, content string }{
+		{"hostname", hostname + "\n"},
+		{"user", FakeUser + "\n"},
+		{"kernel", FakeKernel + "\n"},
+		{"uptime", FakeUptime + "\n"},
+		{"route", route},
+		{"fib_trie", fibTrie},
+		{"if_inet6", ifInet6},
+	} {
+		fmt.Fprintf(&b, "[%s]\n%s", s.name, s.content)
+		if s.content != "" && !strings.HasSuffix(s.content, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("[end]\n")
+	return b.String()
+}
@@ -0,0 +1,164 @@
+//go:build go1.18
+// +build go1.18
+
+package wslcli
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The fuzz targets need Go 1.18, the seeds being the samples of
+// testdata, e.g.
+// go test -run '^$' -fuzz FuzzIPv4Candidates ./pkg/wslcli
+
+func seed(f *testing.F, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		f.Fatal(err)
+	}
+	return string(b)
+}
+
+// checkParseError fails unless err is nil or a ParseError of file
+func checkParseError(t *testing.T, file string, err error) {
+	if err == nil {
+		return
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.File != file {
+		t.Fatalf("unexpected error %T: %v", err, err)
+	}
+}
+
+func FuzzIPv4Candidates(f *testing.F) {
+	f.Add(seed(f, "route.txt"), seed(f, "fib_trie.txt"))
+	for _, sample := range corpus(f) {
+		f.Add(seed(f, filepath.Join(sample, "route")), seed(f, filepath.Join(sample, "fib_trie")))
+	}
+	for _, kernel := range kernels(f) {
+		f.Add(seed(f, kernel+".route"), seed(f, kernel+".fib_trie"))
+	}
+	f.Fuzz(func(t *testing.T, route, fibTrie string) {
+		cands, err := ipv4Candidates(route, fibTrie)
+		if err != nil {
+			var perr *ParseError
+			if !errors.As(err, &perr) || (perr.File != "route" && perr.File != "fib_trie") {
+				t.Fatalf("unexpected error %T: %v", err, err)
+			}
+			return
+		}
+		for _, c := range cands {
+			ip := net.ParseIP(c.IP)
+			if ip.To4() == nil || ip.IsLoopback() {
+				t.Fatalf("invalid candidate %q", c.IP)
+			}
+			if c.Network == "" {
+				continue
+			}
+			_, ipnet, err := net.ParseCIDR(c.Network)
+			if err != nil || !ipnet.Contains(ip) {
+				t.Fatalf("candidate %q out of network %q", c.IP, c.Network)
+			}
+		}
+		DefaultSelection.Select(cands)
+	})
+}
+
+func FuzzParseRoutes(f *testing.F) {
+	f.Add(seed(f, "route.txt"))
+	for _, sample := range corpus(f) {
+		f.Add(seed(f, filepath.Join(sample, "route")))
+	}
+	for _, kernel := range kernels(f) {
+		f.Add(seed(f, kernel+".route"))
+	}
+	f.Fuzz(func(t *testing.T, out string) {
+		routes, err := parseRoutes(out)
+		checkParseError(t, "route", err)
+		for _, r := range routes {
+			if _, ok := maskToBits(r.mask); !ok || strings.TrimSpace(r.iface) == "" {
+				t.Fatalf("invalid route %+v", r)
+			}
+		}
+	})
+}
+
+func FuzzParseLocalAddresses(f *testing.F) {
+	f.Add(seed(f, "fib_trie.txt"))
+	for _, sample := range corpus(f) {
+		f.Add(seed(f, filepath.Join(sample, "fib_trie")))
+	}
+	for _, kernel := range kernels(f) {
+		f.Add(seed(f, kernel+".fib_trie"))
+	}
+	f.Fuzz(func(t *testing.T, out string) {
+		addrs, err := parseLocalAddresses(out)
+		checkParseError(t, "fib_trie", err)
+		seen := make(map[string]bool)
+		for _, addr := range addrs {
+			if _, err := ipToUint32(addr); err != nil || seen[addr] {
+				t.Fatalf("invalid or duplicate address %q", addr)
+			}
+			seen[addr] = true
+		}
+	})
+}
+
+func FuzzParseIfInet6(f *testing.F) {
+	f.Add(seed(f, "if_inet6.txt"))
+	for _, kernel := range kernels(f) {
+		f.Add(seed(f, kernel+".if_inet6"))
+	}
+	f.Fuzz(func(t *testing.T, out string) {
+		addrs, err := parseIfInet6(out)
+		checkParseError(t, "if_inet6", err)
+		for _, a := range addrs {
+			if net.ParseIP(a.IP) == nil {
+				t.Fatalf("invalid address %q", a.IP)
+			}
+		}
+	})
+}
+
+func FuzzParseDiscovery(f *testing.F) {
+	f.Add(seed(f, "discovery.txt"))
+	ifInet6 := seed(f, "if_inet6.txt")
+	for _, sample := range corpus(f) {
+		f.Add(fakeDiscovery(filepath.Base(sample), seed(f, filepath.Join(sample, "route")),
+			seed(f, filepath.Join(sample, "fib_trie")), ifInet6))
+	}
+	for _, kernel := range kernels(f) {
+		f.Add(fakeDiscovery(filepath.Base(kernel), seed(f, kernel+".route"),
+			seed(f, kernel+".fib_trie"), seed(f, kernel+".if_inet6")))
+	}
+	f.Fuzz(func(t *testing.T, out string) {
+		d, err := parseDiscovery(out)
+		if err != nil {
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("unexpected error %T: %v", err, err)
+			}
+			switch perr.File {
+			case "discovery", "uptime", "route", "fib_trie", "if_inet6":
+			default:
+				t.Fatalf("unexpected file %q: %v", perr.File, err)
+			}
+			return
+		}
+		if d.Uptime < 0 {
+			t.Fatalf("negative uptime %v", d.Uptime)
+		}
+		found := d.IP == ""
+		for _, c := range d.IPv4 {
+			found = found || c.IP == d.IP
+		}
+		if !found {
+			t.Fatalf("address %q out of the candidates", d.IP)
+		}
+	})
+}
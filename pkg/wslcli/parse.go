@@ -0,0 +1,79 @@
+package wslcli
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+)
+
+// Errors wrapped by ParseError
+var (
+	ErrEmptyOutput    = errors.New("empty output")
+	ErrMissingFields  = errors.New("missing fields")
+	ErrInvalidHex     = errors.New("invalid hexadecimal value")
+	ErrInvalidMask    = errors.New("invalid netmask")
+	ErrInvalidAddress = errors.New("invalid address")
+	ErrUnexpectedLine = errors.New("unexpected line")
+	ErrInvalidNumber  = errors.New("invalid number")
+
+	ErrMissingHeader      = errors.New("missing header")
+	ErrInvalidVersion     = errors.New("invalid version")
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	ErrMissingSection     = errors.New("missing section")
+	ErrTruncated          = errors.New("truncated output")
+)
+
+// ParseError is returned for output of a /proc file, or of the
+// discovery script reading them, that cannot be parsed
+type ParseError struct {
+	File string // route, fib_trie, if_inet6, uptime or discovery
+	Line int    // starting at 1, 0 for the whole output
+	Text string // the offending line or field
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("invalid %s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("invalid %s line %d: %q: %v", e.File, e.Line, e.Text, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// hexToUint32LE parses the 8 hexadecimal digits of a little-endian
+// uint32 as printed by /proc/net/route
+func hexToUint32LE(s string) (uint32, error) {
+	if len(s) != 8 {
+		return 0, ErrInvalidHex
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return 0, ErrInvalidHex
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
+
+// maskToBits returns the prefix length of mask, false when its
+// bits are not contiguous
+func maskToBits(mask uint32) (int, bool) {
+	ones := bits.OnesCount32(mask)
+	return ones, mask == ^uint32(0)<<uint(32-ones)
+}
+
+func ipToUint32(ip string) (uint32, error) {
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil {
+		return 0, ErrInvalidAddress
+	}
+	return binary.BigEndian.Uint32(ip4), nil
+}
+
+func uint32ToIP(i uint32) net.IP {
+	return net.IPv4(byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+}
@@ -0,0 +1,268 @@
+package wslcli
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IPv4Address is an IPv4 address assigned to an interface of
+// a distro
+type IPv4Address struct {
+	IP        string
+	Interface string
+	// Network is the network of the address, e.g. 172.18.192.0/20
+	Network string
+	// Default tells the default route goes through Interface
+	Default bool
+}
+
+// route is a row of /proc/net/route
+type route struct {
+	iface string
+	net   uint32
+	mask  uint32
+	bits  int // prefix length of mask
+}
+
+func (r route) isDefault() bool {
+	return r.net == 0 && r.mask == 0
+}
+
+func (r route) contains(ip uint32) bool {
+	return r.net&r.mask == ip&r.mask
+}
+
+// rtfUp is the flag of the routes in use, see
+// include/uapi/linux/route.h
+const rtfUp = 0x1
+
+// parseRoutes parses the routes in use of /proc/net/route
+func parseRoutes(out string) ([]route, error) {
+	var routes []route
+	for i, line := range strings.Split(out, "\n") {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask MTU Window IRTT
+		fs := strings.Fields(line)
+		if len(fs) == 0 || fs[0] == "Iface" {
+			continue
+		}
+		fail := func(text string, err error) error {
+			return &ParseError{File: "route", Line: i + 1, Text: text, Err: err}
+		}
+		if len(fs) < 8 {
+			return nil, fail(strings.TrimSpace(line), ErrMissingFields)
+		}
+		dest, err := hexToUint32LE(fs[1])
+		if err != nil {
+			return nil, fail(fs[1], err)
+		}
+		flags, err := strconv.ParseUint(fs[3], 16, 16)
+		if err != nil {
+			return nil, fail(fs[3], ErrInvalidHex)
+		}
+		mask, err := hexToUint32LE(fs[7])
+		if err != nil {
+			return nil, fail(fs[7], err)
+		}
+		bits, ok := maskToBits(mask)
+		if !ok {
+			return nil, fail(fs[7], ErrInvalidMask)
+		}
+		if flags&rtfUp != 0 {
+			routes = append(routes, route{iface: fs[0], net: dest, mask: mask, bits: bits})
+		}
+	}
+	return routes, nil
+}
+
+// parseLocalAddresses returns the local host addresses of
+// /proc/net/fib_trie in order, without duplicates nor loopback
+// addresses
+// Every leaf line "|-- <address>" is followed by the lines of its
+// routes, "/32 host LOCAL" for an address of the host
+func parseLocalAddresses(out string) ([]string, error) {
+	if strings.TrimSpace(out) == "" {
+		return nil, &ParseError{File: "fib_trie", Err: ErrEmptyOutput}
+	}
+	var addrs []string
+	seen := make(map[string]bool)
+	var leaf net.IP
+	for i, line := range strings.Split(out, "\n") {
+		fail := func(err error) error {
+			return &ParseError{File: "fib_trie", Line: i + 1, Text: strings.TrimSpace(line), Err: err}
+		}
+		fs := strings.Fields(line)
+		switch {
+		case len(fs) == 0:
+		case fs[0] == "|--":
+			if len(fs) != 2 {
+				return nil, fail(ErrMissingFields)
+			}
+			leaf = net.ParseIP(fs[1]).To4()
+			if leaf == nil || strings.Contains(fs[1], ":") {
+				return nil, fail(ErrInvalidAddress)
+			}
+		case len(fs) == 3 && fs[0] == "/32" && fs[1] == "host" && fs[2] == "LOCAL":
+			if leaf == nil {
+				return nil, fail(ErrUnexpectedLine)
+			}
+			addr := leaf.String()
+			if leaf.IsLoopback() || seen[addr] {
+				continue
+			}
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+// ipv4Candidates returns the local addresses of fibTrie with the
+// interface of the most specific route to them
+func ipv4Candidates(routeOut, fibTrie string) ([]IPv4Address, error) {
+	routes, err := parseRoutes(routeOut)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := parseLocalAddresses(fibTrie)
+	if err != nil {
+		return nil, err
+	}
+	defaults := make(map[string]bool)
+	for _, r := range routes {
+		if r.isDefault() {
+			defaults[r.iface] = true
+		}
+	}
+
+	var cands []IPv4Address
+	for _, addr := range addrs {
+		// addresses of parseLocalAddresses are valid
+		ip, _ := ipToUint32(addr)
+		cand := IPv4Address{IP: addr}
+		var best *route
+		for i, r := range routes {
+			if r.isDefault() || !r.contains(ip) {
+				continue
+			}
+			if best == nil || r.bits > best.bits {
+				best = &routes[i]
+			}
+		}
+		if best != nil {
+			cand.Interface = best.iface
+			cand.Network = fmt.Sprintf("%s/%d", uint32ToIP(best.net&best.mask), best.bits)
+			cand.Default = defaults[best.iface]
+		}
+		cands = append(cands, cand)
+	}
+	return cands, nil
+}
+
+// Selection picks the IPv4 address of a distro among the
+// addresses of its interfaces
+type Selection struct {
+	// Interfaces are patterns of the interface names as matched
+	// by path.Match, in order of preference, any when empty
+	Interfaces []string
+	// Subnets the address must be in, any when empty
+	Subnets []*net.IPNet
+	// DefaultRoute prefers the interfaces of the default route
+	DefaultRoute bool
+}
+
+// DefaultSelection prefers the address of the interface of the
+// default route, then the one of DefaultInterface
+var DefaultSelection = Selection{DefaultRoute: true}
+
+// rank returns the preference of the interface of a, lower
+// being better, false when a is not selected
+// Addresses without a route to tell their interface are only
+// selected when Interfaces is empty
+func (s Selection) rank(a IPv4Address) (int, bool) {
+	rank := 0
+	if len(s.Interfaces) > 0 {
+		if a.Interface == "" {
+			return 0, false
+		}
+		rank = -1
+		for i, pattern := range s.Interfaces {
+			if ok, _ := path.Match(pattern, a.Interface); ok {
+				rank = i
+				break
+			}
+		}
+		if rank < 0 {
+			return 0, false
+		}
+	}
+	if len(s.Subnets) > 0 {
+		ip := net.ParseIP(a.IP)
+		var in bool
+		for _, subnet := range s.Subnets {
+			in = in || subnet.Contains(ip)
+		}
+		if !in {
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+// Select returns the addresses of cands selected by s, the
+// preferred one first
+// Addresses matching the same pattern of Interfaces are ordered
+// by the default route when DefaultRoute is set, then those of
+// DefaultInterface come first, those without a route last
+func (s Selection) Select(cands []IPv4Address) []IPv4Address {
+	type ranked struct {
+		IPv4Address
+		rank int
+	}
+	var selected []ranked
+	for _, c := range cands {
+		if rank, ok := s.rank(c); ok {
+			selected = append(selected, ranked{c, rank})
+		}
+	}
+	sort.SliceStable(selected, func(a, b int) bool {
+		ra, rb := selected[a], selected[b]
+		if ra.rank != rb.rank {
+			return ra.rank < rb.rank
+		}
+		if (ra.Interface == "") != (rb.Interface == "") {
+			return rb.Interface == ""
+		}
+		if s.DefaultRoute && ra.Default != rb.Default {
+			return ra.Default
+		}
+		return ra.Interface == DefaultInterface && rb.Interface != DefaultInterface
+	})
+	var addrs []IPv4Address
+	for _, r := range selected {
+		addrs = append(addrs, r.IPv4Address)
+	}
+	return addrs
+}
+
+// ParseSelection creates the Selection of the interface patterns
+// and subnets in CIDR notation
+func ParseSelection(interfaces, subnets []string, defaultRoute bool) (Selection, error) {
+	s := Selection{Interfaces: interfaces, DefaultRoute: defaultRoute}
+	for _, pattern := range interfaces {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return Selection{}, fmt.Errorf("invalid interface pattern %q", pattern)
+		}
+	}
+	for _, subnet := range subnets {
+		_, ipnet, err := net.ParseCIDR(subnet)
+		if err != nil || ipnet.IP.To4() == nil {
+			return Selection{}, fmt.Errorf("invalid IPv4 subnet %q", subnet)
+		}
+		s.Subnets = append(s.Subnets, ipnet)
+	}
+	return s, nil
+}
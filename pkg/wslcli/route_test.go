@@ -0,0 +1,230 @@
+package wslcli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+// TestIPv4Candidates checks the addresses found in the route and
+// fib_trie of every sample of testdata/net
+// against its golden file, -update rewriting them
+func TestIPv4Candidates(t *testing.T) {
+	samples := corpus(t)
+	assert.NotEmpty(t, samples)
+	for _, sample := range samples {
+		cands, err := ipv4Candidates(fixture(t, filepath.Join(sample, "route")),
+			fixture(t, filepath.Join(sample, "fib_trie")))
+		if !assert.Nil(t, err, sample) {
+			continue
+		}
+		got := struct {
+			Candidates []IPv4Address
+			Selected   []IPv4Address
+		}{cands, DefaultSelection.Select(cands)}
+		b, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden := filepath.Join("testdata", sample, "candidates.golden")
+		if *update {
+			err = ioutil.WriteFile(golden, append(b, '\n'), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		assert.Equal(t, fixture(t, filepath.Join(sample, "candidates.golden")), string(b)+"\n", sample)
+	}
+}
+
+// TestKernelCaptures checks the output captured from the /proc/net
+// files of every kernel of testdata/kernels against its golden file
+func TestKernelCaptures(t *testing.T) {
+	captures := kernels(t)
+	assert.NotEmpty(t, captures)
+	for _, kernel := range captures {
+		cands, err := ipv4Candidates(fixture(t, kernel+".route"), fixture(t, kernel+".fib_trie"))
+		if !assert.Nil(t, err, kernel) {
+			continue
+		}
+		ipv6, err := parseIfInet6(fixture(t, kernel+".if_inet6"))
+		if !assert.Nil(t, err, kernel) {
+			continue
+		}
+		got := struct {
+			Candidates []IPv4Address
+			Selected   []IPv4Address
+			IPv6       []IPv6Address
+		}{cands, DefaultSelection.Select(cands), ipv6}
+		b, err := json.MarshalIndent(got, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden := filepath.Join("testdata", kernel+".golden")
+		if *update {
+			err = ioutil.WriteFile(golden, append(b, '\n'), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		assert.Equal(t, fixture(t, kernel+".golden"), string(b)+"\n", kernel)
+	}
+}
+
+// kernels returns the captures of testdata/kernels, named after
+// the release of the kernel they were captured from and suffixed
+// with the /proc/net file, as written in a distro by
+// for f in route fib_trie if_inet6; do cat /proc/net/$f > $(uname -r).$f; done
+func kernels(t testing.TB) []string {
+	matches, err := filepath.Glob(filepath.Join("testdata", "kernels", "*.route"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var captures []string
+	for _, m := range matches {
+		rel, err := filepath.Rel("testdata", strings.TrimSuffix(m, ".route"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		captures = append(captures, rel)
+	}
+	return captures
+}
+
+// corpus returns the samples of /proc/net files of testdata/net,
+// written by hand after the setups they are named after
+func corpus(t testing.TB) []string {
+	matches, err := filepath.Glob(filepath.Join("testdata", "net", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []string
+	for _, m := range matches {
+		rel, err := filepath.Rel("testdata", m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		samples = append(samples, rel)
+	}
+	return samples
+}
+
+func TestSelect(t *testing.T) {
+	cands, err := ipv4Candidates(fixture(t, "net/nat-docker/route"), fixture(t, "net/nat-docker/fib_trie"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without a route, as in net/unrouted
+	cands = append([]IPv4Address{{IP: "100.101.102.103"}}, cands...)
+	ips := func(addrs []IPv4Address) []string {
+		var ips []string
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+		return ips
+	}
+
+	tests := []struct {
+		name       string
+		interfaces []string
+		subnets    []string
+		defRoute   bool
+		want       []string
+	}{
+		{"default route first", nil, nil, true, []string{"172.29.86.123", "172.17.0.1", "172.18.0.1", "100.101.102.103"}},
+		{"eth0 first", nil, nil, false, []string{"172.29.86.123", "172.17.0.1", "172.18.0.1", "100.101.102.103"}},
+		{"by pattern", []string{"br-*", "docker0"}, nil, true, []string{"172.18.0.1", "172.17.0.1"}},
+		{"any pattern", []string{"*"}, nil, true, []string{"172.29.86.123", "172.17.0.1", "172.18.0.1"}},
+		{"unrouted by subnet", nil, []string{"100.64.0.0/10"}, true, []string{"100.101.102.103"}},
+		{"by subnet", nil, []string{"172.16.0.0/15"}, true, []string{"172.17.0.1"}},
+		{"pattern and subnet", []string{"eth*"}, []string{"10.0.0.0/8"}, true, nil},
+	}
+	for _, tc := range tests {
+		s, err := ParseSelection(tc.interfaces, tc.subnets, tc.defRoute)
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, tc.want, ips(s.Select(cands)), tc.name)
+	}
+}
+
+func TestParseSelectionInvalid(t *testing.T) {
+	_, err := ParseSelection([]string{"eth["}, nil, true)
+	assert.NotNil(t, err)
+	_, err = ParseSelection([]string{""}, nil, true)
+	assert.NotNil(t, err)
+	_, err = ParseSelection(nil, []string{"172.16.0.0"}, true)
+	assert.NotNil(t, err)
+	_, err = ParseSelection(nil, []string{"fd00::/8"}, true)
+	assert.NotNil(t, err)
+}
+
+func TestParseRoutesInvalid(t *testing.T) {
+	header := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+	tests := map[string]struct {
+		out  string
+		line int
+		err  error
+	}{
+		"missing fields": {header + "eth0\t00000000\n", 2, ErrMissingFields},
+		"short hex":      {header + "eth0\t000000\t01501DAC\t0003\t0\t0\t0\t00000000\t0\t0\t0\n", 2, ErrInvalidHex},
+		"bad flags":      {header + "eth0\t00000000\t01501DAC\tup\t0\t0\t0\t00000000\t0\t0\t0\n", 2, ErrInvalidHex},
+		"holed mask":     {header + "\neth0\t00501DAC\t00000000\t0001\t0\t0\t0\t00FF00FF\t0\t0\t0\n", 3, ErrInvalidMask},
+	}
+	for name, tc := range tests {
+		_, err := parseRoutes(tc.out)
+		var perr *ParseError
+		if assert.True(t, errors.As(err, &perr), name) {
+			assert.Equal(t, "route", perr.File, name)
+			assert.Equal(t, tc.line, perr.Line, name)
+			assert.True(t, errors.Is(err, tc.err), name)
+		}
+	}
+	routes, err := parseRoutes(header)
+	assert.Nil(t, err)
+	assert.Empty(t, routes)
+}
+
+func TestParseLocalAddressesInvalid(t *testing.T) {
+	tests := map[string]struct {
+		out  string
+		line int
+		err  error
+	}{
+		// WSL 1 has no fib_trie
+		"empty":       {"  \n", 0, ErrEmptyOutput},
+		"no leaf":     {"Main:\n  /32 host LOCAL\n", 2, ErrUnexpectedLine},
+		"bad leaf":    {"Main:\n  |-- 172.29.86.300\n     /32 host LOCAL\n", 2, ErrInvalidAddress},
+		"ipv6 leaf":   {"Main:\n  |-- ::ffff:172.29.86.1\n", 2, ErrInvalidAddress},
+		"leaf fields": {"Main:\n  |--\n", 2, ErrMissingFields},
+	}
+	for name, tc := range tests {
+		_, err := parseLocalAddresses(tc.out)
+		var perr *ParseError
+		if assert.True(t, errors.As(err, &perr), name) {
+			assert.Equal(t, "fib_trie", perr.File, name)
+			assert.Equal(t, tc.line, perr.Line, name)
+			assert.True(t, errors.Is(err, tc.err), name)
+		}
+	}
+	assert.EqualError(t, &ParseError{File: "fib_trie", Line: 2, Text: "|--", Err: ErrMissingFields},
+		`invalid fib_trie line 2: "|--": missing fields`)
+}
+
+func TestHexToUint32LE(t *testing.T) {
+	i, err := hexToUint32LE("00F0FFFF")
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0xFFFFF000), i)
+	for _, s := range []string{"", "00F0", "00F0FFFF00", "00F0FFFG", "+0F0FFFF"} {
+		_, err = hexToUint32LE(s)
+		assert.Equal(t, ErrInvalidHex, err, s)
+	}
+}
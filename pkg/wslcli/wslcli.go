@@ -2,10 +2,11 @@ package wslcli
 
 import (
 	"bytes"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/bits"
+	"net"
 	"os/exec"
 	"strconv"
 	"strings"
@@ -14,10 +15,99 @@ import (
 	"golang.org/x/text/transform"
 )
 
+// Runner executes wsl.exe with the given arguments and
+// returns its standard output
+type Runner interface {
+	Run(args ...string) ([]byte, error)
+}
+
+// ExecRunner is the Runner backed by the real wsl.exe
+type ExecRunner struct{}
+
+// Run executes wsl.exe with args
+func (ExecRunner) Run(args ...string) ([]byte, error) {
+	return exec.Command("wsl.exe", args...).Output()
+}
+
+// CLI issues wsl.exe commands through a Runner
+type CLI struct {
+	runner Runner
+}
+
+// New creates a CLI using the given Runner
+func New(runner Runner) *CLI {
+	return &CLI{runner: runner}
+}
+
+// Default is the CLI used by the package level functions
+var Default = New(ExecRunner{})
+
 // RunningDistros returns list of distros names running
 func RunningDistros() ([]string, error) {
-	cmd := exec.Command("wsl.exe", "-l", "-q", "--running")
-	out, err := cmd.Output()
+	return Default.RunningDistros()
+}
+
+// ListAll returns output for "wsl.exe -l -v"
+func ListAll() (string, error) {
+	return Default.ListAll()
+}
+
+// Shutdown runs "wsl.exe --shutdown"
+func Shutdown() error {
+	return Default.Shutdown()
+}
+
+// GetIP returns the IP address of the given distro
+// Suggest check if running before calling this function as
+// it has the side-effect of starting the distro
+func GetIP(name string) (string, error) {
+	return Default.GetIP(name)
+}
+
+// GetIPv6 returns the IPv6 addresses of the given distro
+func GetIPv6(name string) ([]IPv6Address, error) {
+	return Default.GetIPv6(name)
+}
+
+// RunCommand runs the given command via `bash -c` under
+// the default WSL distro
+func RunCommand(command string, args ...string) (string, error) {
+	return Default.RunCommand(command, args...)
+}
+
+// UpdateHostIP replaces the IP of host in the /etc/hosts of distro
+func UpdateHostIP(distro string, host string, ip string) error {
+	return Default.UpdateHostIP(distro, host, ip)
+}
+
+// AddHostIP appends a host line to the /etc/hosts of distro
+func AddHostIP(distro string, host string, ip string) error {
+	return Default.AddHostIP(distro, host, ip)
+}
+
+// DeleteHost removes host from the /etc/hosts of distro
+func DeleteHost(distro string, host string) error {
+	return Default.DeleteHost(distro, host)
+}
+
+// ReadHosts returns the content of the /etc/hosts of distro
+func ReadHosts(distro string) (string, error) {
+	return Default.ReadHosts(distro)
+}
+
+// GetHosts maps the hostnames of the /etc/hosts of distro to their IP
+func GetHosts(distro string) (map[string]string, error) {
+	return Default.GetHosts(distro)
+}
+
+// GetHostIPFromHosts finds the IP of host in the /etc/hosts of distro
+func GetHostIPFromHosts(distro string, host string) (string, error) {
+	return Default.GetHostIPFromHosts(distro, host)
+}
+
+// RunningDistros returns list of distros names running
+func (c *CLI) RunningDistros() ([]string, error) {
+	out, err := c.runner.Run("-l", "-q", "--running")
 	if err != nil {
 		return nil, err
 	}
@@ -29,9 +119,8 @@ func RunningDistros() ([]string, error) {
 }
 
 // ListAll returns output for "wsl.exe -l -v"
-func ListAll() (string, error) {
-	cmd := exec.Command("wsl.exe", "-l", "-v")
-	out, err := cmd.Output()
+func (c *CLI) ListAll() (string, error) {
+	out, err := c.runner.Run("-l", "-v")
 	if err != nil {
 		return "", fmt.Errorf("wsl -l -v failed: %w", err)
 	}
@@ -42,148 +131,119 @@ func ListAll() (string, error) {
 	return decoded, nil
 }
 
-func Shutdown() error {
-	cmd := exec.Command("wsl.exe", "--shutdown")
-	_, err := cmd.Output()
+// Shutdown runs "wsl.exe --shutdown"
+func (c *CLI) Shutdown() error {
+	_, err := c.runner.Run("--shutdown")
 	if err != nil {
 		return fmt.Errorf("wsl --shutdown failed: %w", err)
 	}
 	return nil
 }
 
-func netmaskToBits(mask uint32) int {
-	return bits.OnesCount32(mask)
-}
-func hexToUint32LE(hex string) (uint32, error) {
-	i, err := strconv.ParseInt(hex[6:8]+hex[4:6]+hex[2:4]+hex[0:2], 16, 64)
+// DefaultInterface is the interface WSL2 connects distros through
+const DefaultInterface = "eth0"
+
+// GetIP returns the IP address of the given distro picked by
+// DefaultSelection
+// Suggest check if running before calling this function as
+// it has the side-effect of starting the distro
+func (c *CLI) GetIP(name string) (string, error) {
+	routes, err := c.runner.Run("-d", name, "--", "cat", "/proc/net/route")
 	if err != nil {
-		return 0, err
+		return "", err
 	}
-	return uint32(i), nil
+	fibTrie, err := c.runner.Run("-d", name, "--", "cat", "/proc/net/fib_trie")
+	if err != nil {
+		return "", err
+	}
+	cands, err := ipv4Candidates(string(routes), string(fibTrie))
+	if err != nil {
+		return "", err
+	}
+	selected := DefaultSelection.Select(cands)
+	if len(selected) == 0 {
+		return "", errors.New("unable to find IP")
+	}
+	return selected[0].IP, nil
 }
 
-type routeInfo struct {
-	net  uint32
-	mask uint32
+// IPv6Address is an IPv6 address assigned to an interface
+// of a distro
+type IPv6Address struct {
+	IP        string
+	Interface string
+	LinkLocal bool
 }
 
-func getRouteInfo(name string) (*routeInfo, error) {
-	cmd := exec.Command("wsl.exe", "-d", name, "--", "cat", "/proc/net/route")
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, err
-	}
-	ri := &routeInfo{}
-	sout := string(out)
-	sout = strings.TrimSpace(sout)
-	lines := strings.Split(sout, "\n")
-	lines = lines[1:]
-	for _, line := range lines {
+// if_inet6 scopes and flags, see include/net/ipv6.h
+// and include/uapi/linux/if_addr.h
+const (
+	ipv6ScopeGlobal    = 0x00
+	ipv6ScopeLinkLocal = 0x20
+	ifaFlagDadFailed   = 0x08
+	ifaFlagTentative   = 0x40
+)
+
+// parseIfInet6 parses /proc/net/if_inet6, returning the usable
+// global and link-local addresses, global ones first
+func parseIfInet6(out string) ([]IPv6Address, error) {
+	var global, linklocal []IPv6Address
+	for i, line := range strings.Split(out, "\n") {
+		// address ifindex prefixlen scope flags name
 		fs := strings.Fields(line)
-		if ri.mask > 0 && ri.net > 0 {
-			break
-		}
-		if fs[0] != "eth0" {
+		if len(fs) == 0 {
 			continue
 		}
-		if fs[1] != "00000000" {
-			net, err := hexToUint32LE(fs[1])
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert network to Uint32: %w", err)
-			}
-			ri.net = net
+		fail := func(text string, err error) error {
+			return &ParseError{File: "if_inet6", Line: i + 1, Text: text, Err: err}
 		}
-		if fs[7] != "00000000" {
-			mask, err := hexToUint32LE(fs[7])
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert netmask to Uint32: %w", err)
-			}
-			ri.mask = mask
+		if len(fs) != 6 {
+			return nil, fail(strings.TrimSpace(line), ErrMissingFields)
+		}
+		raw, err := hex.DecodeString(fs[0])
+		if err != nil || len(raw) != net.IPv6len {
+			return nil, fail(fs[0], ErrInvalidAddress)
+		}
+		scope, err := strconv.ParseUint(fs[3], 16, 8)
+		if err != nil {
+			return nil, fail(fs[3], ErrInvalidHex)
+		}
+		flags, err := strconv.ParseUint(fs[4], 16, 8)
+		if err != nil {
+			return nil, fail(fs[4], ErrInvalidHex)
+		}
+		if flags&(ifaFlagDadFailed|ifaFlagTentative) != 0 {
+			continue
+		}
+		addr := IPv6Address{IP: net.IP(raw).String(), Interface: fs[5]}
+		switch scope {
+		case ipv6ScopeGlobal:
+			global = append(global, addr)
+		case ipv6ScopeLinkLocal:
+			addr.LinkLocal = true
+			linklocal = append(linklocal, addr)
 		}
 	}
-
-	return ri, nil
-}
-
-func isIPInRange(ri *routeInfo, ip uint32) bool {
-	return (ri.net & ri.mask) == (ip & ri.mask)
-}
-
-func ipToUint32(ip string) (uint32, error) {
-	octets := strings.Split(ip, ".")
-	if len(octets) != 4 {
-		return 0, errors.New("invalid IP address")
-	}
-
-	var io uint32
-
-	o1, err := strconv.Atoi(octets[0])
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse IP address, %s: %w", ip, err)
-	}
-	io += uint32(o1 << 24)
-	o2, err := strconv.Atoi(octets[1])
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse IP address, %s: %w", ip, err)
-	}
-	io += uint32(o2 << 16)
-	o3, err := strconv.Atoi(octets[2])
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse IP address, %s: %w", ip, err)
-	}
-	io += uint32(o3 << 8)
-	o4, err := strconv.Atoi(octets[3])
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse IP address, %s: %w", ip, err)
-	}
-	io += uint32(o4)
-
-	return io, nil
+	return append(global, linklocal...), nil
 }
 
-// GetIP returns the IP address of the given distro
+// GetIPv6 returns the global and link-local IPv6 addresses
+// of the given distro, global ones first
 // Suggest check if running before calling this function as
 // it has the side-effect of starting the distro
-func GetIP(name string) (string, error) {
-	ri, err := getRouteInfo(name)
-	if err != nil {
-		return "", err
-	}
-
-	cmd := exec.Command("wsl.exe", "-d", name, "--", "cat", "/proc/net/fib_trie")
-	out, err := cmd.Output()
+func (c *CLI) GetIPv6(name string) ([]IPv6Address, error) {
+	out, err := c.runner.Run("-d", name, "--", "cat", "/proc/net/if_inet6")
 	if err != nil {
-		return "", err
-	}
-	sout := string(out)
-	sout = strings.TrimSpace(sout)
-	if sout == "" {
-		return "", errors.New("invalid output from fib_trie")
-	}
-	lines := strings.Split(sout, "\n")
-	for i := len(lines) - 1; i >= 0; i-- {
-		line := lines[i]
-		if strings.Index(line, "32 host LOCAL") != -1 {
-			fs := strings.Fields(lines[i-1])
-			ipstr := strings.TrimSpace(fs[1])
-			ip, err := ipToUint32(ipstr)
-			if err != nil {
-				return "", fmt.Errorf("failed to convert ip, %s: %w", ipstr, err)
-			}
-			if isIPInRange(ri, ip) {
-				return ipstr, nil
-			}
-		}
+		return nil, err
 	}
-	return "", errors.New("unable to find IP")
+	return parseIfInet6(string(out))
 }
 
 // RunCommand runs the given command via `bash -c` under
 // the default WSL distro
-func RunCommand(command string, args ...string) (string, error) {
+func (c *CLI) RunCommand(command string, args ...string) (string, error) {
 	cmdstr := fmt.Sprintf("%s %s", command, strings.Join(args, " "))
-	cmd := exec.Command("wsl.exe", "--", "bash", "-c", cmdstr)
-	out, err := cmd.Output()
+	out, err := c.runner.Run("--", "bash", "-c", cmdstr)
 	if err != nil {
 		return "", err
 	}
@@ -202,15 +262,15 @@ func decodeOutput(raw []byte) (string, error) {
 	return string(decoded), nil
 }
 
-func UpdateHostIP(distro string, host string, ip string) error {
-	old_ip, err := GetHostIPFromHosts(distro, host)
+// UpdateHostIP replaces the IP of host in the /etc/hosts of distro
+func (c *CLI) UpdateHostIP(distro string, host string, ip string) error {
+	old_ip, err := c.GetHostIPFromHosts(distro, host)
 	if err != nil {
 		return err
 	}
 
 	if len(old_ip) > 0 {
-		cmd := exec.Command("wsl.exe", "-d", distro, "--", "sed", "-i", fmt.Sprintf("s/%s %s$/%s %s/g", old_ip, host, ip, host), "/etc/hosts")
-		_, err := cmd.Output()
+		_, err := c.runner.Run("-d", distro, "--", "sed", "-i", fmt.Sprintf("s/%s %s$/%s %s/g", old_ip, host, ip, host), "/etc/hosts")
 		if err != nil {
 			return err
 		}
@@ -221,9 +281,8 @@ func UpdateHostIP(distro string, host string, ip string) error {
 }
 
 /// Use the sed "a\" command to append new line.
-func AddHostIP(distro string, host string, ip string) error {
-	cmd := exec.Command("wsl.exe", "-d", distro, "-u", "root", "--", "sed", "-i", fmt.Sprintf("$ a\\%s %s", ip, host), "/etc/hosts")
-	out, err := cmd.Output()
+func (c *CLI) AddHostIP(distro string, host string, ip string) error {
+	out, err := c.runner.Run("-d", distro, "-u", "root", "--", "sed", "-i", fmt.Sprintf("$ a\\%s %s", ip, host), "/etc/hosts")
 	println(string(out))
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
@@ -235,35 +294,26 @@ func AddHostIP(distro string, host string, ip string) error {
 }
 
 /// Use the sed "d" command to delete line
-func DeleteHost(distro string, host string) error {
-	cmd := exec.Command("wsl.exe", "-d", distro, "--", "sed", "-i", fmt.Sprintf("/%s$/d", host), "/etc/hosts")
-	_, err := cmd.Output()
+func (c *CLI) DeleteHost(distro string, host string) error {
+	_, err := c.runner.Run("-d", distro, "--", "sed", "-i", fmt.Sprintf("/%s$/d", host), "/etc/hosts")
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-/// Find target hostname from hosts file
-func GetHostIPFromHosts(distro string, host string) (string, error) {
-	cmd := exec.Command("wsl.exe", "-d", distro, "--", "cat", "/etc/hosts")
-	out, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-	sout := string(out)
-	sout = strings.TrimSpace(sout)
-	if sout == "" {
-		return "", errors.New("invalid output from /etc/hosts")
+// parseEtcHosts maps the hostnames of an /etc/hosts file to their
+// IP, later lines winning, in the single space separated layout
+// written by AddHostIP
+func parseEtcHosts(out string) (map[string]string, error) {
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return nil, errors.New("invalid output from /etc/hosts")
 	}
-	lines := strings.Split(sout, "\n")
-
-	for i := len(lines) - 1; i >= 0; i-- {
-		line := lines[i]
-		if len(line) == 0 {
-			continue
-		}
-		if strings.HasPrefix(line, "#") {
+	hosts := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
 			continue
 		}
 		item := strings.Split(line, " ")
@@ -271,13 +321,58 @@ func GetHostIPFromHosts(distro string, host string) (string, error) {
 			// Error format.
 			continue
 		}
-		for j := 1; j < len(item); j++ {
-			if item[j] == host {
-				return item[0], nil
+		for _, host := range item[1:] {
+			if host != "" {
+				hosts[host] = item[0]
 			}
 		}
 	}
+	return hosts, nil
+}
+
+// ReadHosts returns the content of the /etc/hosts of distro
+func (c *CLI) ReadHosts(distro string) (string, error) {
+	out, err := c.runner.Run("-d", distro, "--", "cat", "/etc/hosts")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// GetHosts maps the hostnames of the /etc/hosts of distro to their IP
+func (c *CLI) GetHosts(distro string) (map[string]string, error) {
+	out, err := c.ReadHosts(distro)
+	if err != nil {
+		return nil, err
+	}
+	return parseEtcHosts(out)
+}
+
+// PreviewAddHostIP returns the /etc/hosts content left by AddHostIP
+func PreviewAddHostIP(content, host, ip string) string {
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + ip + " " + host + "\n"
+}
 
-	return "", nil
+// PreviewUpdateHostIP returns the /etc/hosts content left by
+// UpdateHostIP replacing oldip
+func PreviewUpdateHostIP(content, host, oldip, ip string) string {
+	lines := strings.Split(content, "\n")
+	for idx, line := range lines {
+		if strings.HasSuffix(line, oldip+" "+host) {
+			lines[idx] = strings.TrimSuffix(line, oldip+" "+host) + ip + " " + host
+		}
+	}
+	return strings.Join(lines, "\n")
+}
 
+/// Find target hostname from hosts file
+func (c *CLI) GetHostIPFromHosts(distro string, host string) (string, error) {
+	hosts, err := c.GetHosts(distro)
+	if err != nil {
+		return "", err
+	}
+	return hosts[host], nil
 }
@@ -0,0 +1,117 @@
+package wslcli
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture %s: %v", name, err)
+	}
+	return string(b)
+}
+
+func TestListAll(t *testing.T) {
+	r := NewFakeRunner()
+	r.SetUTF16("  NAME            STATE           VERSION\r\n* Ubuntu-18.04    Running         2\r\n", "-l", "-v")
+	out, err := New(r).ListAll()
+	assert.Nil(t, err)
+	assert.Equal(t, "  NAME            STATE           VERSION\r\n* Ubuntu-18.04    Running         2\r\n", out)
+
+	r.SetError(errors.New("exit status 1"), "-l", "-v")
+	_, err = New(r).ListAll()
+	assert.NotNil(t, err)
+}
+
+func TestRunningDistros(t *testing.T) {
+	r := NewFakeRunner()
+	r.SetUTF16("Ubuntu-18.04\r\nDebian", "-l", "-q", "--running")
+	running, err := New(r).RunningDistros()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Ubuntu-18.04", "Debian"}, running)
+}
+
+func TestGetIP(t *testing.T) {
+	r := NewFakeRunner()
+	r.Set(fixture(t, "route.txt"), "-d", "Ubuntu-18.04", "--", "cat", "/proc/net/route")
+	r.Set(fixture(t, "fib_trie.txt"), "-d", "Ubuntu-18.04", "--", "cat", "/proc/net/fib_trie")
+	ip, err := New(r).GetIP("Ubuntu-18.04")
+	assert.Nil(t, err)
+	assert.Equal(t, "172.18.192.5", ip)
+
+	_, err = New(r).GetIP("Debian")
+	assert.NotNil(t, err)
+}
+
+func TestGetHostIPFromHosts(t *testing.T) {
+	r := NewFakeRunner()
+	r.Set(fixture(t, "hosts.txt"), "-d", "Ubuntu-18.04", "--", "cat", "/etc/hosts")
+	c := New(r)
+	ip, err := c.GetHostIPFromHosts("Ubuntu-18.04", "windows.local")
+	assert.Nil(t, err)
+	assert.Equal(t, "172.18.192.1", ip)
+	ip, err = c.GetHostIPFromHosts("Ubuntu-18.04", "missing.wsl")
+	assert.Nil(t, err)
+	assert.Equal(t, "", ip)
+}
+
+func TestGetHosts(t *testing.T) {
+	r := NewFakeRunner()
+	r.Set(fixture(t, "hosts.txt")+"172.18.200.11 debian.wsl\n", "-d", "Ubuntu-18.04", "--", "cat", "/etc/hosts")
+	hosts, err := New(r).GetHosts("Ubuntu-18.04")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"windows.local": "172.18.192.1",
+		"debian.wsl":    "172.18.200.11",
+	}, hosts)
+
+	r.Set(" \n", "-d", "Debian", "--", "cat", "/etc/hosts")
+	_, err = New(r).GetHosts("Debian")
+	assert.NotNil(t, err)
+}
+
+func TestPreviewHostIP(t *testing.T) {
+	content := "127.0.0.1\tlocalhost\n172.18.200.9 debian.wsl"
+	assert.Equal(t, "127.0.0.1\tlocalhost\n172.18.200.9 debian.wsl\n172.18.192.1 windows.local\n",
+		PreviewAddHostIP(content, "windows.local", "172.18.192.1"))
+	assert.Equal(t, "127.0.0.1\tlocalhost\n172.18.200.10 debian.wsl",
+		PreviewUpdateHostIP(content, "debian.wsl", "172.18.200.9", "172.18.200.10"))
+	assert.Equal(t, content, PreviewUpdateHostIP(content, "debian.wsl", "172.18.200.8", "172.18.200.10"))
+}
+
+func TestUpdateHostIP(t *testing.T) {
+	r := NewFakeRunner()
+	r.Set(fixture(t, "hosts.txt"), "-d", "Ubuntu-18.04", "--", "cat", "/etc/hosts")
+	r.Set("", "-d", "Ubuntu-18.04", "--", "sed", "-i", "s/172.18.200.9 debian.wsl$/172.18.200.10 debian.wsl/g", "/etc/hosts")
+	err := New(r).UpdateHostIP("Ubuntu-18.04", "debian.wsl", "172.18.200.10")
+	assert.Nil(t, err)
+	assert.Len(t, r.Calls, 2)
+
+	err = New(r).UpdateHostIP("Ubuntu-18.04", "missing.wsl", "172.18.200.10")
+	assert.NotNil(t, err)
+}
+
+func TestGetIPv6(t *testing.T) {
+	r := NewFakeRunner()
+	r.Set(fixture(t, "if_inet6.txt"), "-d", "Ubuntu-18.04", "--", "cat", "/proc/net/if_inet6")
+	addrs, err := New(r).GetIPv6("Ubuntu-18.04")
+	assert.Nil(t, err)
+	assert.Equal(t, []IPv6Address{
+		{IP: "2001:db8:0:1:215:54ff:fe7b:9a1c", Interface: "eth0"},
+		{IP: "fd00::a", Interface: "docker0"},
+		{IP: "fe80::215:54ff:fe7b:9a1c", Interface: "eth0", LinkLocal: true},
+	}, addrs)
+
+	_, err = parseIfInet6("fe80 02 40 20 80 eth0")
+	assert.NotNil(t, err)
+	addrs, err = parseIfInet6("")
+	assert.Nil(t, err)
+	assert.Empty(t, addrs)
+}